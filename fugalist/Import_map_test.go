@@ -2,10 +2,12 @@ package fugalist
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/mhcoffin/go-doricolib/doricolib"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -84,9 +86,14 @@ func TestFormatMidiEvents(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			assert.Equal(t, test.expected, FormatMidiEvents(test.actions))
+			actual, err := FormatMidiEvents(test.actions)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actual)
 		})
 	}
+
+	_, err := FormatMidiEvents([]doricolib.SwitchAction{{Type: "kNoSuchAction", Param1: "1"}})
+	assert.NotNil(t, err)
 }
 
 func TestFormatMidiDynamic(t *testing.T) {
@@ -100,6 +107,8 @@ func TestFormatMidiDynamic(t *testing.T) {
 		{"velocity part range", doricolib.VolumeType{Type: "kNoteVelocity"}, "10,110", "velocity 10:110"},
 		{"cc full range", doricolib.VolumeType{Type: "kCC", Param1: "13"}, "0,127", "CC13"},
 		{"cc part range", doricolib.VolumeType{Type: "kCC", Param1: "13"}, "10,30", "CC13 10:30"},
+		{"cc alias", doricolib.VolumeType{Type: "kCC", Param1: "11"}, "0,127", "expression"},
+		{"cc alias part range", doricolib.VolumeType{Type: "kCC", Param1: "1"}, "10,30", "mod 10:30"},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -152,10 +161,42 @@ func TestFormatBranch(t *testing.T) {
 		expected string
 	}{
 		{"empty", "", ""},
+		{"clause", "NoteLength < kShort", "nl < short"},
+		{"range", "NoteLength >= kMedium AND NoteLength < kLong", "medium <= nl < long"},
+		{"reversed range", "NoteLength <= kLong AND NoteLength > kVeryShort", "veryShort < nl <= long"},
+		{"conjunction", "NoteLength != kShort AND NoteLength != kLong", "nl != short and nl != long"},
+		{"disjunction", "NoteLength < kShort OR NoteLength == kVeryLong", "nl < short or nl == veryLong"},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			assert.Equal(t, test.expected, FormatBranch(test.value))
+			actual, err := FormatBranch(test.value)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actual)
+			conditions, err := Input(actual).ParseBranchConditions()
+			assert.Nil(t, err)
+			assert.Equal(t, actual, FormatConditions(conditions))
+		})
+	}
+}
+
+func TestFormatBranch_Unrepresentable(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		offset int
+	}{
+		{"unknown variable", "Pitch < 60", 0},
+		{"unknown constant", "NoteLength < kTiny", 13},
+		{"missing operator", "NoteLength kShort", 11},
+		{"dangling conjunction", "NoteLength < kShort AND", 23},
+		{"parentheses", "(NoteLength < kShort)", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := FormatBranch(test.value)
+			var perr *ParseError
+			assert.True(t, errors.As(err, &perr))
+			assert.Equal(t, test.offset, perr.Offset)
 		})
 	}
 }
@@ -169,45 +210,51 @@ func TestBuildPtMap(t *testing.T) {
 			name: "Ref",
 			expected: PtMap{
 				"pt.legato": {
-					"NoteLength <= medium": {
-						On:    "KS25, PC6, CC1=64",
-						Dyn:   "velocity 1:127",
-						Len:   "",
-						Trans: "0",
+					"nl <= medium": {
+						On:     "KS25, PC6, CC1=64",
+						Dyn:    "velocity 1:127",
+						Len:    "",
+						Trans:  "0",
+						Switch: 3,
 					},
-					"NoteLength > medium": {
-						On:    "KS26, PC6, CC1=64",
-						Dyn:   "CC2 1:120",
-						Len:   "95",
-						Trans: "-1",
+					"nl > medium": {
+						On:     "KS26, PC6, CC1=64",
+						Dyn:    "breath 1:120",
+						Len:    "95",
+						Trans:  "-1",
+						Switch: 4,
 					},
 				},
 				"pt.marcato+pt.nonVibrato+pt.plucked": {
 					"": {
-						On:    "KS24, PC13, CC7=23",
-						Dyn:   "velocity 1:127",
-						Len:   "",
-						Trans: "0",
+						On:     "KS24, PC13, CC7=23",
+						Dyn:    "velocity 1:127",
+						Len:    "",
+						Trans:  "0",
+						Switch: 5,
 					},
 				},
 				"pt.natural": {
-					"NoteLength < medium": {
-						On:    "KS12=120, KS24, PC15, CC4=64",
-						Dyn:   "velocity 10:120",
-						Len:   "",
-						Trans: "0",
+					"nl < medium": {
+						On:     "KS12=120, KS24, PC15, CC4=64",
+						Dyn:    "velocity 10:120",
+						Len:    "",
+						Trans:  "0",
+						Switch: 1,
 					},
-					"NoteLength >= long": {
-						On:    "KS12=120, KS24, PC13, CC4=64",
-						Dyn:   "CC2 10:120",
-						Len:   "",
-						Trans: "0",
+					"nl >= long": {
+						On:     "KS12=120, KS24, PC13, CC4=64",
+						Dyn:    "breath 10:120",
+						Len:    "",
+						Trans:  "0",
+						Switch: 2,
 					},
-					"NoteLength >= medium AND NoteLength < long": {
-						On:    "KS12=120, KS24, PC13, CC4=64",
-						Dyn:   "velocity 10:120",
-						Trans: "0",
-						Len:   "",
+					"medium <= nl < long": {
+						On:     "KS12=120, KS24, PC13, CC4=64",
+						Dyn:    "velocity 10:120",
+						Trans:  "0",
+						Len:    "",
+						Switch: 0,
 					},
 				},
 			},
@@ -318,3 +365,27 @@ func addTechniques(axes []Axis, extras map[int]string) []Axis {
 	}
 	return axes
 }
+
+func TestImportTints(t *testing.T) {
+	project := &Project{Tints: map[string]*Tint{
+		"a": {Id: "a", Name: "Accent", Order: 100, Midi: "CC1=10"},
+		"c": {Id: "c", Name: `Custom: "growl"`, Order: 200, Midi: "KS30"},
+	}}
+	addOns, err := project.CreateTechniqueAddOns()
+	if !assert.Nil(t, err) {
+		return
+	}
+	tints, err := ImportTints(*addOns)
+	if !assert.Nil(t, err) {
+		return
+	}
+	names := make([]string, 0)
+	for _, tint := range tints {
+		names = append(names, tint.Name+" | "+tint.Midi)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"Accent | CC1=10", `Custom: "growl" | KS30`}, names)
+
+	_, err = ImportTints(doricolib.TechniqueAddOnList{TechniqueAddOns: []doricolib.TechniqueAddOn{{TechniqueIDs: "pt.nonesuch"}}})
+	assert.NotNil(t, err)
+}
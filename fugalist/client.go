@@ -4,6 +4,7 @@ import (
 	"cloud.google.com/go/firestore"
 	"context"
 	"fmt"
+	"time"
 )
 
 const projectID = "fugalist"
@@ -16,6 +17,7 @@ func client(ctx context.Context) (*firestore.Client, error) {
 	return client, nil
 }
 
+// Client is the Firestore implementation of Store.
 type Client struct {
 	client *firestore.Client
 	uid    string
@@ -44,6 +46,9 @@ func (c *Client) ReadUserInfo(ctx context.Context) (*UserInfo, error) {
 
 func (c *Client) ReadProject(ctx context.Context, pid ProjectId) (*Project, error) {
 	snap, err := c.client.Collection("Users").Doc(c.uid).Collection("Projects").Doc(pid).Get(ctx)
+	if snap != nil && !snap.Exists() {
+		return nil, fmt.Errorf("failed to read document %s: %w", pid, ErrNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read document: %w", err)
 	}
@@ -122,3 +127,114 @@ func (c *Client) WriteShare(ctx context.Context, share Share) error {
 	}
 	return nil
 }
+
+// CreateProject writes a new project and its summary in one transaction. The project id is
+// generated if empty and the create and modify times are set. Fails if the project exists.
+// An old middle C string is stored by name.
+func (c *Client) CreateProject(ctx context.Context, project *Project, summary *ProjectSummary) error {
+	created, createdSummary := prepareNewProject(project, summary)
+	user := c.client.Collection("Users").Doc(c.uid)
+	projectDoc := user.Collection("Projects").Doc(created.ProjectId)
+	summaryDoc := user.Collection("Summaries").Doc(created.ProjectId)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		err := tx.Create(projectDoc, created)
+		if err != nil {
+			return err
+		}
+		return tx.Create(summaryDoc, createdSummary)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create project %s.%s: %w", c.uid, created.ProjectId, err)
+	}
+	*project, *summary = created, createdSummary
+	return nil
+}
+
+// UpdateProject replaces a project and, if summary is not nil, its summary in one transaction.
+// The update is rejected with ErrStaleProject unless project.ModifyTime matches the stored
+// project. On success the modify times are advanced. An old middle C string is stored by
+// name.
+func (c *Client) UpdateProject(ctx context.Context, project *Project, summary *ProjectSummary) error {
+	pid := project.ProjectId
+	user := c.client.Collection("Users").Doc(c.uid)
+	projectDoc := user.Collection("Projects").Doc(pid)
+	summaryDoc := user.Collection("Summaries").Doc(pid)
+	var created, now time.Time
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(projectDoc)
+		if err != nil {
+			return err
+		}
+		var stored Project
+		err = snap.DataTo(&stored)
+		if err != nil {
+			return err
+		}
+		if !stored.ModifyTime.Equal(project.ModifyTime) {
+			return ErrStaleProject
+		}
+		created = stored.CreateTime
+		now = storeTime()
+		updated := *project
+		updated.MiddleC = project.MiddleC.Named()
+		updated.CreateTime = created
+		updated.ModifyTime = now
+		err = tx.Set(projectDoc, updated)
+		if err != nil {
+			return err
+		}
+		if summary == nil {
+			return tx.Update(summaryDoc, []firestore.Update{
+				{
+					Path:  "ModifyTime",
+					Value: now,
+				},
+			})
+		}
+		updatedSummary := *summary
+		updatedSummary.ProjectID = pid
+		updatedSummary.ModifyTime = now
+		return tx.Set(summaryDoc, updatedSummary)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update project %s.%s: %w", c.uid, pid, err)
+	}
+	project.MiddleC = project.MiddleC.Named()
+	project.CreateTime = created
+	project.ModifyTime = now
+	if summary != nil {
+		summary.ProjectID = pid
+		summary.ModifyTime = now
+	}
+	return nil
+}
+
+// DeleteProject deletes a project, its summary and every Share record made from it in one
+// transaction.
+func (c *Client) DeleteProject(ctx context.Context, pid ProjectId) error {
+	user := c.client.Collection("Users").Doc(c.uid)
+	projectDoc := user.Collection("Projects").Doc(pid)
+	summaryDoc := user.Collection("Summaries").Doc(pid)
+	shares := c.client.Collection("Shared").Where("PID", "==", pid).Where("UID", "==", c.uid)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.Documents(shares).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, snap := range snaps {
+			err = tx.Delete(snap.Ref)
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Delete(summaryDoc)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(projectDoc)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete project %s.%s: %w", c.uid, pid, err)
+	}
+	return nil
+}
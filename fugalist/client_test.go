@@ -3,6 +3,7 @@ package fugalist
 import (
 	"cloud.google.com/go/firestore"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -182,3 +183,70 @@ func TestClient_SetUrl(t *testing.T) {
 	assert.WithinDuration(t, time.Now(), p.ExpressionMapTime, 200*time.Millisecond)
 
 }
+
+func TestClient_UpdateProject(t *testing.T) {
+	uid := SetUp()
+	ctx := context.Background()
+	cl, err := NewClient(ctx, uid)
+	assert.Nil(t, err)
+	p := project1
+	p.ProjectId = ""
+	s := summary1
+	err = cl.CreateProject(ctx, &p, &s)
+	assert.Nil(t, err)
+
+	stale, err := cl.ReadProject(ctx, p.ProjectId)
+	assert.Nil(t, err)
+	p.MiddleC = "C3"
+	err = cl.UpdateProject(ctx, &p, nil)
+	assert.Nil(t, err)
+	err = cl.UpdateProject(ctx, stale, nil)
+	assert.True(t, errors.Is(err, ErrStaleProject))
+
+	stored, err := cl.ReadProject(ctx, p.ProjectId)
+	assert.Nil(t, err)
+	assert.Equal(t, Yamaha, stored.MiddleC)
+	assert.WithinDuration(t, p.ModifyTime, stored.ModifyTime, 0)
+}
+
+func TestClient_CreateImportedProject(t *testing.T) {
+	uid := SetUp()
+	ctx := context.Background()
+	cl, err := NewClient(ctx, uid)
+	assert.Nil(t, err)
+	imported, summary, _, err := ImportExpressionMap(getXmap(ReadDoricolib(t, "Ref")))
+	if !assert.Nil(t, err) {
+		return
+	}
+	err = cl.CreateProject(ctx, imported, summary)
+	if !assert.Nil(t, err) {
+		return
+	}
+	stored, err := cl.ReadProject(ctx, imported.ProjectId)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, imported.Assignments, stored.Assignments)
+	assert.Equal(t, imported.CompositeSounds, stored.CompositeSounds)
+	assert.Equal(t, imported.VstSounds, stored.VstSounds)
+}
+
+func TestClient_DeleteProject(t *testing.T) {
+	uid := SetUp()
+	ctx := context.Background()
+	cl, err := NewClient(ctx, uid)
+	assert.Nil(t, err)
+	s := summary1
+	s.Version = 1
+	err = cl.WriteShare(ctx, Share{UID: uid, PID: pid, Summary: s})
+	assert.Nil(t, err)
+
+	err = cl.DeleteProject(ctx, pid)
+	assert.Nil(t, err)
+	_, err = cl.ReadProject(ctx, pid)
+	assert.NotNil(t, err)
+	_, err = cl.ReadProjectSummary(ctx, pid)
+	assert.NotNil(t, err)
+	_, err = firestoreClient.Collection("Shared").Doc(fmt.Sprintf("%s.%d", pid, 1)).Get(ctx)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,166 @@
+package fugalist
+
+import (
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestActionCodecs_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"key switch", "KS60"},
+		{"key switch velocity", "KS60=100"},
+		{"note", "C#3"},
+		{"flat becomes sharp", "Db3"},
+		{"negative octave", "A-1"},
+		{"CC", "CC1=64"},
+		{"fraction", "CC32=3/8"},
+		{"whole fraction", "CC32=4/4"},
+		{"program", "PC7"},
+		{"pitch bend", "PB=-4096"},
+		{"pressure", "AT=90"},
+		{"channel", "CH3"},
+		{"relative channel", "CH-2"},
+		{"note with velocity", "C#3=64"},
+		{"NRPN", "NRPN300=1000"},
+		{"RPN", "RPN0=256"},
+		{"14-bit CC", "CC14:1=9000"},
+		{"mixed", "C1, CC1=1/2, KS20=64, PC3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, err := ParseActionList(test.input, "C3", nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			formatted, err := FormatActionsLike(actions, test.input, "C3", nil)
+			assert.Nil(t, err)
+			reparsed, err := ParseActionList(formatted, "C3", nil, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, actions, reparsed)
+			if test.name != "flat becomes sharp" {
+				assert.Equal(t, test.input, formatted)
+			}
+		})
+	}
+}
+
+func TestFormatActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		like     string
+		expected string
+	}{
+		{"default notation", "C3, CC1=1/2", "", "KS60, CC1=32"},
+		{"spacing", " c3 ,cc 1 = 1/2 ", "C3, CC1=1/2", "C3, CC1=1/2"},
+		{"changed fraction", "CC1=1/2", "CC1=1/3", "CC1=32"},
+		{"fraction with new denominator", "CC1=3/4", "CC1=1/4", "CC1=3/4"},
+		{"added action", "PC3, C3", "C3", "PC3, C3"},
+		{"note with velocity", "KS20=64, C3", "C3", "G#-1=64, KS60"},
+		{"bad reference", "C3", "C3, XX", "KS60"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, err := ParseActionList(test.input, "C3", nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			actual, err := FormatActionsLike(actions, test.like, "C3", nil)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestFormatActions_NoNotation(t *testing.T) {
+	_, err := FormatActions([]doricolib.SwitchAction{{Type: "kBogus", Param1: "1"}})
+	assert.NotNil(t, err)
+}
+
+func TestFormatNote(t *testing.T) {
+	tests := []struct {
+		number   int
+		octave   int
+		expected string
+	}{
+		{60, 4, "C4"},
+		{60, 3, "C3"},
+		{61, 4, "C#4"},
+		{59, 4, "B3"},
+		{0, 4, "C-1"},
+		{0, 3, "C-2"},
+		{127, 4, "G9"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			assert.Equal(t, test.expected, FormatNote(test.number, test.octave))
+			actual, err := ParseMidiActions(test.expected, test.octave)
+			assert.Nil(t, err)
+			if assert.Len(t, actual, 1) {
+				assert.Equal(t, "kKeySwitch", actual[0].Type)
+			}
+		})
+	}
+}
+
+func TestNoteCodec_Accidentals(t *testing.T) {
+	tests := []struct {
+		input    string
+		number   string
+		velocity string
+	}{
+		{"C3", "60", "127"},
+		{"C#3", "61", "127"},
+		{"C♯3", "61", "127"},
+		{"C##3", "62", "127"},
+		{"C𝄪3", "62", "127"},
+		{"Db3", "61", "127"},
+		{"D♭3", "61", "127"},
+		{"Dbb3", "60", "127"},
+		{"D♭♭3", "60", "127"},
+		{"D𝄫3", "60", "127"},
+		{"Bb2 = 90", "58", "90"},
+		{"cb3=0", "59", "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			actions, err := ParseActionList(test.input, Yamaha, nil, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, []doricolib.SwitchAction{{Type: "kKeySwitch", Param1: test.number, Param2: test.velocity}}, actions)
+		})
+	}
+}
+
+func TestFormatActionsAsNotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		middleC  OctaveConvention
+		expected string
+	}{
+		{"yamaha", "KS60, KS61=64", Yamaha, "C3, C#3=64"},
+		{"scientific", "KS60, KS61=64", Scientific, "C4, C#4=64"},
+		{"default", "KS0", "", "C-1"},
+		{"mixed", "KS24, CC1=1/2, PC3", Yamaha, "C0, CC1=32, PC3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, err := ParseActionList(test.input, test.middleC, nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			actual, err := FormatActionsAsNotes(actions, test.middleC)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestFormatActionsAsNotes_UnknownConvention(t *testing.T) {
+	_, err := FormatActionsAsNotes([]doricolib.SwitchAction{{Type: "kKeySwitch", Param1: "60", Param2: "127"}}, "C7")
+	assert.NotNil(t, err)
+}
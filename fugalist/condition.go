@@ -30,13 +30,193 @@ func (cond *Condition) String() string {
 	return strings.Join(clauses, conj)
 }
 
+// ParseBranchCondition parses a branch condition that Dorico can express as a single
+// condition string.
 func (in Input) ParseBranchCondition() (Condition, error) {
-	cond, err := in.ParseRange()
-	if err == nil {
-		return cond, nil
+	conditions, err := in.ParseBranchConditions()
+	if err != nil {
+		return Condition{}, err
+	}
+	if len(conditions) != 1 {
+		return Condition{}, fmt.Errorf("condition needs %d combinations: %s", len(conditions), in)
+	}
+	return conditions[0], nil
+}
+
+// ParseBranchConditions parses a branch condition, which may combine clauses and ranges
+// with AND, OR, NOT and parentheses, into the disjunction of Dorico conditions it stands
+// for. Dorico conditions cannot express OR, so each one needs a combination of its own, and
+// the conditions are made disjoint so that no note matches two of them. An empty condition
+// is always true.
+//
+//	condition := term { OR term }
+//	term      := factor { AND factor }
+//	factor    := NOT factor | "(" condition ")" | range | clause
+func (in Input) ParseBranchConditions() ([]Condition, error) {
+	if in.Empty() {
+		return []Condition{{And, []Clause{}}}, nil
+	}
+	rest, conditions, err := in.parseDisjunction()
+	if err != nil {
+		return nil, locate(err, in)
+	}
+	if !rest.Empty() {
+		return nil, locate(rest.expected("AND", "OR"), in)
+	}
+	return conditions, nil
+}
+
+func (in Input) parseDisjunction() (Input, []Condition, error) {
+	rest, result, err := in.parseConjunction()
+	if err != nil {
+		return in, nil, err
+	}
+	for {
+		next, conj, err := rest.MustBeConjunction()
+		if err != nil || conj != Or {
+			return rest, result, nil
+		}
+		var rhs []Condition
+		rest, rhs, err = next.parseConjunction()
+		if err != nil {
+			return in, nil, err
+		}
+		result = orConditions(result, rhs)
 	}
-	cond, err = in.ParseClauseList()
-	return cond, err
+}
+
+func (in Input) parseConjunction() (Input, []Condition, error) {
+	rest, result, err := in.parseFactor()
+	if err != nil {
+		return in, nil, err
+	}
+	for {
+		next, conj, err := rest.MustBeConjunction()
+		if err != nil || conj != And {
+			return rest, result, nil
+		}
+		var rhs []Condition
+		rest, rhs, err = next.parseFactor()
+		if err != nil {
+			return in, nil, err
+		}
+		result = andConditions(result, rhs)
+	}
+}
+
+var notRegexp = regexp.MustCompile(`(?i)^not\b`)
+var openRegexp = regexp.MustCompile(`^\(`)
+var closeRegexp = regexp.MustCompile(`^\)`)
+
+func (in Input) parseFactor() (Input, []Condition, error) {
+	if rest, _, err := in.MustBe(notRegexp); err == nil {
+		rest, operand, err := rest.parseFactor()
+		if err != nil {
+			return in, nil, err
+		}
+		return rest, negateConditions(operand), nil
+	}
+	if rest, _, err := in.MustBe(openRegexp); err == nil {
+		rest, inner, err := rest.parseDisjunction()
+		if err != nil {
+			return in, nil, err
+		}
+		rest, _, err = rest.MustBe(closeRegexp)
+		if err != nil {
+			return in, nil, rest.expected("AND", "OR", ")")
+		}
+		return rest, inner, nil
+	}
+	rest, cond, rangeErr := in.parseRange()
+	if rangeErr == nil {
+		return rest, []Condition{cond}, nil
+	}
+	rest, clause, clauseErr := in.ParseClause()
+	if clauseErr == nil {
+		return rest, []Condition{{And, []Clause{clause}}}, nil
+	}
+	return in, nil, furthest(furthest(in.expected("NOT", "("), rangeErr), clauseErr)
+}
+
+// andConditions returns the disjunction equivalent to (a1 OR a2 ...) AND (b1 OR b2 ...),
+// leaving out the conjunctions that hold for no note length.
+func andConditions(a []Condition, b []Condition) []Condition {
+	result := make([]Condition, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			clauses := make([]Clause, 0, len(x.clauses)+len(y.clauses))
+			clauses = append(clauses, x.clauses...)
+			clauses = append(clauses, y.clauses...)
+			cond := Condition{And, clauses}
+			if cond.lengths() == 0 {
+				continue
+			}
+			result = append(result, cond)
+		}
+	}
+	return result
+}
+
+// orConditions returns a disjunction equivalent to (a1 OR a2 ...) OR (b1 OR b2 ...) whose
+// conditions are disjoint if those of a and b are: a, then (NOT a) AND b.
+func orConditions(a []Condition, b []Condition) []Condition {
+	return append(a, simplify(andConditions(negateConditions(a), b))...)
+}
+
+// negateConditions returns the disjunction equivalent to NOT (c1 OR c2 ...), that is
+// (NOT c1) AND (NOT c2) ..., where NOT (x1 AND x2 ...) is the disjoint disjunction
+// (NOT x1) OR (x1 AND NOT x2) OR ...
+func negateConditions(conditions []Condition) []Condition {
+	result := []Condition{{And, []Clause{}}}
+	for _, cond := range conditions {
+		negated := make([]Condition, len(cond.clauses))
+		for k, clause := range cond.clauses {
+			clauses := make([]Clause, k+1)
+			copy(clauses, cond.clauses[:k])
+			clause.operator = clause.operator.Negation()
+			clauses[k] = clause
+			negated[k] = Condition{And, clauses}
+		}
+		result = simplify(andConditions(result, negated))
+	}
+	return result
+}
+
+// simplify drops the conditions that hold for no note length, and the clauses that don't
+// change the note lengths their condition holds for.
+func simplify(conditions []Condition) []Condition {
+	result := make([]Condition, 0, len(conditions))
+	for _, cond := range conditions {
+		lengths := cond.lengths()
+		if lengths == 0 {
+			continue
+		}
+		for k := 0; k < len(cond.clauses); {
+			clauses := make([]Clause, 0, len(cond.clauses)-1)
+			clauses = append(clauses, cond.clauses[:k]...)
+			clauses = append(clauses, cond.clauses[k+1:]...)
+			shorter := Condition{cond.connector, clauses}
+			if shorter.lengths() == lengths {
+				cond = shorter
+			} else {
+				k++
+			}
+		}
+		result = append(result, cond)
+	}
+	return result
+}
+
+// lengths returns the set of note lengths the condition holds for, as a bit mask indexed
+// like NoteLengths.
+func (cond *Condition) lengths() int {
+	mask := 0
+	for k, length := range NoteLengths {
+		if cond.Holds(length) {
+			mask |= 1 << k
+		}
+	}
+	return mask
 }
 
 func (in Input) ParseClauseList() (Condition, error) {
@@ -47,15 +227,16 @@ func (in Input) ParseClauseList() (Condition, error) {
 		var clause Clause
 		rest, clause, err = rest.ParseClause()
 		if err != nil {
-			return Condition{}, err
+			return Condition{}, locate(err, in)
 		}
 		clauses = append(clauses, clause)
 		if !rest.Empty() {
 			var c Conjunction
-			rest, c, err = rest.MustBeConjunction()
+			next, c, err := rest.MustBeConjunction()
 			if err != nil || c != And {
-				return Condition{}, fmt.Errorf(`"AND"" expected`)
+				return Condition{}, locate(rest.expected("AND"), in)
 			}
+			rest = next
 		}
 	}
 	return Condition{And, clauses}, nil
@@ -67,15 +248,15 @@ func (in Input) ParseComparisonNoteLengthFirst() (Input, Clause, error) {
 	var err error
 	rest, result.lhs, err = rest.MustBeVariable()
 	if err != nil {
-		return in, Clause{}, fmt.Errorf("identifier expected")
+		return in, Clause{}, err
 	}
 	rest, result.operator, err = rest.MustBeComparisonOperator()
 	if err != nil {
-		return in, Clause{}, fmt.Errorf("comparison operator expected")
+		return in, Clause{}, err
 	}
 	rest, result.rhs, err = rest.MustBeConstant()
 	if err != nil {
-		return in, Clause{}, fmt.Errorf("constant expected")
+		return in, Clause{}, err
 	}
 	return rest, result, nil
 }
@@ -86,16 +267,16 @@ func (in Input) ParseComparisonLengthConstantFirst() (Input, Clause, error) {
 	var err error
 	rest, result.rhs, err = rest.MustBeConstant()
 	if err != nil {
-		return in, Clause{}, fmt.Errorf("identifier expected")
+		return in, Clause{}, err
 	}
 	rest, result.operator, err = rest.MustBeComparisonOperator()
 	if err != nil {
-		return in, Clause{}, fmt.Errorf("comparison operator expected")
+		return in, Clause{}, err
 	}
 	result.operator = result.operator.Opposite()
 	rest, result.lhs, err = rest.MustBeVariable()
 	if err != nil {
-		return in, Clause{}, fmt.Errorf("constant expected")
+		return in, Clause{}, err
 	}
 	return rest, result, nil
 }
@@ -105,14 +286,27 @@ func (in Input) ParseClause() (Input, Clause, error) {
 	if err == nil {
 		return rest, result, err
 	}
-	rest, result, err = in.ParseComparisonLengthConstantFirst()
-	if err == nil {
-		return rest, result, err
+	rest, result, err2 := in.ParseComparisonLengthConstantFirst()
+	if err2 == nil {
+		return rest, result, nil
 	}
-	return in, Clause{}, fmt.Errorf("clause expected")
+	return in, Clause{}, furthest(err, err2)
 }
 
 func (in Input) ParseRange() (Condition, error) {
+	rest, cond, err := in.parseRange()
+	if err != nil {
+		return Condition{}, locate(err, in)
+	}
+	if !rest.Empty() {
+		return Condition{}, locate(rest.expected("end of input"), in)
+	}
+	return cond, nil
+}
+
+var rangeOperatorRegexp = regexp.MustCompile(`^<=?`)
+
+func (in Input) parseRange() (Input, Condition, error) {
 	var rest = in
 	var lhs Constant
 	var op1 string
@@ -123,23 +317,23 @@ func (in Input) ParseRange() (Condition, error) {
 
 	rest, lhs, err = rest.MustBeConstant()
 	if err != nil {
-		return Condition{}, fmt.Errorf("length constant expected")
+		return in, Condition{}, err
 	}
-	rest, op1, err = rest.MustBe(regexp.MustCompile("<=?"))
+	rest, op1, err = rest.MustBe(rangeOperatorRegexp)
 	if err != nil {
-		return Condition{}, fmt.Errorf("range operator expected")
+		return in, Condition{}, rest.expected("<", "<=")
 	}
 	rest, nl, err = rest.MustBeVariable()
 	if err != nil {
-		return Condition{}, fmt.Errorf("NoteLength expected")
+		return in, Condition{}, err
 	}
-	rest, op2, err = rest.MustBe(regexp.MustCompile("<=?"))
+	rest, op2, err = rest.MustBe(rangeOperatorRegexp)
 	if err != nil {
-		return Condition{}, fmt.Errorf("range operator expected")
+		return in, Condition{}, rest.expected("<", "<=")
 	}
 	rest, rhs, err = rest.MustBeConstant()
 	if err != nil {
-		return Condition{}, fmt.Errorf("length constant expected")
+		return in, Condition{}, err
 	}
 	if op1 == "<=" {
 		op1 = ">="
@@ -161,5 +355,95 @@ func (in Input) ParseRange() (Condition, error) {
 			},
 		},
 	}
-	return condition, nil
+	return rest, condition, nil
+}
+
+var doricoVariableRegexp = regexp.MustCompile(`^NoteLength\b`)
+var doricoConstantRegexp = regexp.MustCompile(`^k[A-Za-z]+`)
+
+// ParseDoricoCondition parses the condition string of a Dorico combination, such as
+// "NoteLength >= kMedium AND NoteLength < kLong", into the disjunction of conditions it
+// stands for. AND binds tighter than OR. An empty condition is always true.
+func ParseDoricoCondition(s string) ([]Condition, error) {
+	in := Input(s)
+	current := Condition{And, []Clause{}}
+	if in.Empty() {
+		return []Condition{current}, nil
+	}
+	result := make([]Condition, 0)
+	rest := in
+	for {
+		var clause Clause
+		var err error
+		rest, clause, err = rest.parseDoricoClause()
+		if err != nil {
+			return nil, locate(err, in)
+		}
+		current.clauses = append(current.clauses, clause)
+		if rest.Empty() {
+			break
+		}
+		var conj Conjunction
+		rest, conj, err = rest.MustBeConjunction()
+		if err != nil {
+			return nil, locate(err, in)
+		}
+		if conj == Or {
+			result = append(result, current)
+			current = Condition{And, []Clause{}}
+		}
+	}
+	return append(result, current), nil
+}
+
+func (in Input) parseDoricoClause() (Input, Clause, error) {
+	rest, _, err := in.MustBe(doricoVariableRegexp)
+	if err != nil {
+		return in, Clause{}, in.expected(string(NoteLength))
+	}
+	rest, op, err := rest.MustBeComparisonOperator()
+	if err != nil {
+		return in, Clause{}, err
+	}
+	next, name, err := rest.MustBe(doricoConstantRegexp)
+	if err == nil {
+		for _, length := range NoteLengths {
+			if length.String() == name {
+				return next, Clause{operator: op, lhs: NoteLength, rhs: length}, nil
+			}
+		}
+	}
+	names := make([]string, len(NoteLengths))
+	for k, length := range NoteLengths {
+		names[k] = length.String()
+	}
+	return in, Clause{}, rest.expected(names...)
+}
+
+// FormatConditions writes a disjunction of conditions in the canonical syntax that
+// ParseBranchConditions reads back: "nl < short", "short <= nl < long", joined with "and"
+// and "or".
+func FormatConditions(conditions []Condition) string {
+	parts := make([]string, len(conditions))
+	for k, cond := range conditions {
+		parts[k] = cond.format()
+	}
+	return strings.Join(parts, " or ")
+}
+
+func (cond *Condition) format() string {
+	if len(cond.clauses) == 2 {
+		lo, hi := cond.clauses[0], cond.clauses[1]
+		if lo.operator == LT || lo.operator == LE {
+			lo, hi = hi, lo
+		}
+		if (lo.operator == GT || lo.operator == GE) && (hi.operator == LT || hi.operator == LE) {
+			return fmt.Sprintf("%s %s nl %s %s", string(lo.rhs), lo.operator.Opposite(), hi.operator, string(hi.rhs))
+		}
+	}
+	clauses := make([]string, len(cond.clauses))
+	for k, clause := range cond.clauses {
+		clauses[k] = fmt.Sprintf("nl %s %s", clause.operator, string(clause.rhs))
+	}
+	return strings.Join(clauses, " and ")
 }
@@ -172,3 +172,95 @@ func TestInput_ParseBranch(t *testing.T) {
 		})
 	}
 }
+
+func TestInput_ParseBranchConditions(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"", []string{""}},
+		{"nl < short", []string{"NoteLength < kShort"}},
+		{"short >= nl", []string{"NoteLength <= kShort"}},
+		{"nl < short or nl > long", []string{"NoteLength < kShort", "NoteLength > kLong"}},
+		{"nl < short OR short < nl < long", []string{"NoteLength < kShort", "NoteLength > kShort AND NoteLength < kLong"}},
+		{"not nl < short", []string{"NoteLength >= kShort"}},
+		{"NOT (nl < short or nl > long)", []string{"NoteLength >= kShort AND NoteLength <= kLong"}},
+		{"not (short <= nl < long)", []string{"NoteLength < kShort", "NoteLength >= kLong"}},
+		{"(nl < short or nl > long) and nl != veryShort", []string{"NoteLength > kLong AND NoteLength != kVeryShort"}},
+		{"nl == short and nl == medium or nl == long", []string{"NoteLength == kLong"}},
+		{"nl == short and nl == medium", []string{}},
+		{"(nl < short or nl > long) and nl > medium", []string{"NoteLength > kLong AND NoteLength > kMedium"}},
+		{"not not nl == medium", []string{"NoteLength == kMedium"}},
+		{"((nl < medium))", []string{"NoteLength < kMedium"}},
+		{"nl < medium or nl < long", []string{"NoteLength < kMedium", "NoteLength >= kMedium AND NoteLength < kLong"}},
+		{"nl < long or nl < medium", []string{"NoteLength < kLong"}},
+		{"nl > short or nl < long", []string{"NoteLength > kShort", "NoteLength <= kShort"}},
+		{"not (nl > short and nl > medium)", []string{"NoteLength <= kShort", "NoteLength > kShort AND NoteLength <= kMedium"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conditions, err := Input(test.name).ParseBranchConditions()
+			assert.Nil(t, err)
+			actual := make([]string, len(conditions))
+			for k, cond := range conditions {
+				actual[k] = cond.String()
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestInput_ParseBranchConditions_Disjoint(t *testing.T) {
+	tests := []string{
+		"nl < medium or nl < long",
+		"nl <= short or short <= nl < long or nl != medium",
+		"not (nl > short and nl < long) or nl == medium",
+		"(nl < short or nl > long) and (nl != veryShort or nl == veryLong)",
+	}
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			conditions, err := Input(test).ParseBranchConditions()
+			assert.Nil(t, err)
+			for _, length := range NoteLengths {
+				matches := 0
+				for _, cond := range conditions {
+					if cond.Holds(length) {
+						matches++
+					}
+				}
+				assert.True(t, matches <= 1, "%s matches %d conditions", length, matches)
+			}
+		})
+	}
+}
+
+func TestInput_ParseBranchConditions_Failure(t *testing.T) {
+	tests := []struct {
+		name string
+	}{
+		{"nl < short or"},
+		{"(nl < short"},
+		{"nl < short)"},
+		{"not"},
+		{"nl < short nl > long"},
+		{"ornament < short"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Input(test.name).ParseBranchConditions()
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestInput_ParseBranchCondition_Disjunction(t *testing.T) {
+	_, err := Input("nl < short or nl > long").ParseBranchCondition()
+	assert.NotNil(t, err)
+}
+
+func TestComparisonOperator_Negation(t *testing.T) {
+	for _, op := range []ComparisonOperator{LT, LE, EQ, NE, GT, GE} {
+		assert.Equal(t, op, op.Negation().Negation())
+		assert.NotEqual(t, op, op.Negation())
+	}
+}
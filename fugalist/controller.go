@@ -0,0 +1,106 @@
+package fugalist
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Controllers maps controller aliases to MIDI controller numbers, so that an action list
+// can say "expression=100" for "CC11=100" and a dynamics spec "expression 0:127" for
+// "CC11 0:127". A project's own aliases add to, and may override, StandardControllers.
+// Aliases are matched without regard to case.
+type Controllers map[string]int
+
+// StandardControllers are the aliases every project understands.
+var StandardControllers = Controllers{
+	"mod":        1,
+	"breath":     2,
+	"foot":       4,
+	"volume":     7,
+	"pan":        10,
+	"expression": 11,
+	"UACC":       32,
+	"sustain":    64,
+}
+
+var ControllerNamePat = regexp.MustCompile(`^[A-Za-z_]+$`)
+
+// reservedNames are the words of the action and dynamics notations, which cannot be aliases.
+var reservedNames = []string{"CC", "KS", "PC", "PB", "AT", "CH", "NRPN", "RPN", "velocity"}
+
+// Controller returns the controller number of an alias.
+func (c Controllers) Controller(name string) (int, bool) {
+	for _, controllers := range []Controllers{c, StandardControllers} {
+		for _, alias := range controllers.SortedNames() {
+			if strings.EqualFold(alias, name) {
+				return controllers[alias], true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Alias returns the alias of a controller number, preferring the project's own aliases, or
+// "" if it has none.
+func (c Controllers) Alias(number int) string {
+	for _, controllers := range []Controllers{c, StandardControllers} {
+		for _, alias := range controllers.SortedNames() {
+			if controllers[alias] == number {
+				return alias
+			}
+		}
+	}
+	return ""
+}
+
+// controllerName writes a controller number as its alias if it has one, or else as "CCn".
+func (c Controllers) controllerName(number string) string {
+	if n, err := strconv.Atoi(number); err == nil {
+		if alias := c.Alias(n); alias != "" {
+			return alias
+		}
+	}
+	return "CC" + number
+}
+
+// copy returns a copy of the aliases that can be changed independently, or nil for nil.
+func (c Controllers) copy() Controllers {
+	if c == nil {
+		return nil
+	}
+	result := make(Controllers, len(c))
+	for name, number := range c {
+		result[name] = number
+	}
+	return result
+}
+
+// SortedNames returns the aliases in order.
+func (c Controllers) SortedNames() []string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkAlias checks that an alias can be told apart from the rest of the notation and
+// names a MIDI controller.
+func checkAlias(name string, number int) error {
+	if !ControllerNamePat.MatchString(name) {
+		return fmt.Errorf("bad controller name: %q", name)
+	}
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(name, reserved) {
+			return fmt.Errorf("reserved controller name: %q", name)
+		}
+	}
+	if number < 0 || number > 127 {
+		return fmt.Errorf("controller out of range 0..127: %d", number)
+	}
+	return nil
+}
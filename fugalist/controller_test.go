@@ -0,0 +1,133 @@
+package fugalist
+
+import (
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestControllers_Controller(t *testing.T) {
+	controllers := Controllers{"dynamics": 1, "expression": 2}
+	tests := []struct {
+		name     string
+		expected int
+		ok       bool
+	}{
+		{"mod", 1, true},
+		{"Sustain", 64, true},
+		{"uacc", 32, true},
+		{"dynamics", 1, true},
+		{"DYNAMICS", 1, true},
+		{"expression", 2, true},
+		{"wobble", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			number, ok := controllers.Controller(test.name)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, number)
+		})
+	}
+}
+
+func TestControllers_Alias(t *testing.T) {
+	controllers := Controllers{"dynamics": 1}
+	assert.Equal(t, "dynamics", controllers.Alias(1))
+	assert.Equal(t, "expression", controllers.Alias(11))
+	assert.Equal(t, "UACC", controllers.Alias(32))
+	assert.Equal(t, "", controllers.Alias(13))
+	assert.Equal(t, "mod", Controllers(nil).Alias(1))
+}
+
+func TestParseActionList_Aliases(t *testing.T) {
+	controllers := Controllers{"dynamics": 21}
+	tests := []struct {
+		name     string
+		input    string
+		expected []doricolib.SwitchAction
+	}{
+		{"standard", "expression=100", []doricolib.SwitchAction{{Type: "kControlChange", Param1: "11", Param2: "100"}}},
+		{"case and space", " SUSTAIN = 0 ", []doricolib.SwitchAction{{Type: "kControlChange", Param1: "64", Param2: "0"}}},
+		{"project", "dynamics=64, KS20", []doricolib.SwitchAction{
+			{Type: "kControlChange", Param1: "21", Param2: "64"},
+			{Type: "kKeySwitch", Param1: "20", Param2: "127"},
+		}},
+		{"UACC", "UACC=42", []doricolib.SwitchAction{{Type: "kControlChange", Param1: "32", Param2: "42"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, err := ParseActionList(test.input, "C3", nil, controllers)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actions)
+		})
+	}
+
+	_, err := ParseActionList("wobble=3", "C3", nil, controllers)
+	assert.NotNil(t, err)
+	_, err = ParseActionList("dynamics=3", "C3", nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestFormatActionsLike_Aliases(t *testing.T) {
+	controllers := Controllers{"dynamics": 21}
+	actions, err := ParseActionList("mod=64, CC11=90, dynamics=3", "C3", nil, controllers)
+	if !assert.Nil(t, err) {
+		return
+	}
+	formatted, err := FormatActionsLike(actions, "mod=1, CC11=1, dynamics=1", "C3", controllers)
+	assert.Nil(t, err)
+	assert.Equal(t, "mod=64, CC11=90, dynamics=3", formatted)
+	formatted, err = FormatActionsLike(actions, "", "C3", controllers)
+	assert.Nil(t, err)
+	assert.Equal(t, "CC1=64, CC11=90, CC21=3", formatted)
+}
+
+func TestParseVolumeSpec_Aliases(t *testing.T) {
+	controllers := Controllers{"dynamics": 21}
+	tests := []struct {
+		input    string
+		expected doricolib.VolumeType
+		rng      string
+	}{
+		{"expression", doricolib.VolumeType{Type: "kCC", Param1: "11"}, "0,127"},
+		{"mod 10:120", doricolib.VolumeType{Type: "kCC", Param1: "1"}, "10,120"},
+		{" Dynamics 0:100 ", doricolib.VolumeType{Type: "kCC", Param1: "21"}, "0,100"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			volType, rng, err := ParseVolumeSpec(test.input, controllers)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, test.expected, *volType)
+			assert.Equal(t, test.rng, rng)
+		})
+	}
+}
+
+func TestValidate_Controllers(t *testing.T) {
+	project := &Project{
+		ProjectId: "p",
+		Controllers: Controllers{
+			"dynamics": 21,
+			"PB":       3,
+			"cc7":      7,
+			"huge":     200,
+		},
+		VstSounds: map[VstSoundId]*VstSound{
+			"v": {Id: "v", Name: "v", Midi: "dynamics=10", Dynamics: "dynamics 0:127"},
+			"w": {Id: "w", Name: "w", Midi: "loudness=10", Dynamics: "loudness"},
+		},
+	}
+	var addresses []string
+	for _, d := range Validate(project) {
+		addresses = append(addresses, d.Entity+" "+d.Id+" "+d.Field)
+	}
+	assert.Equal(t, []string{
+		"controller PB Name",
+		"controller cc7 Name",
+		"controller huge Name",
+		"vstSound w Midi",
+		"vstSound w Dynamics",
+	}, addresses)
+}
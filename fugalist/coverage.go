@@ -0,0 +1,208 @@
+package fugalist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NoteLengths are the note lengths Dorico distinguishes, shortest first.
+var NoteLengths = []Constant{VeryShort, Short, Medium, Long, VeryLong}
+
+func lengthIndex(c Constant) int {
+	for k, length := range NoteLengths {
+		if length == c {
+			return k
+		}
+	}
+	panic("no such constant")
+}
+
+// Holds reports whether the clause is true of notes of the given length.
+func (clause *Clause) Holds(length Constant) bool {
+	a, b := lengthIndex(length), lengthIndex(clause.rhs)
+	switch clause.operator {
+	case LT:
+		return a < b
+	case LE:
+		return a <= b
+	case EQ:
+		return a == b
+	case NE:
+		return a != b
+	case GT:
+		return a > b
+	case GE:
+		return a >= b
+	default:
+		panic("no such comparison operator")
+	}
+}
+
+// Holds reports whether every clause of the condition is true of notes of the given length.
+func (cond *Condition) Holds(length Constant) bool {
+	for _, clause := range cond.clauses {
+		if !clause.Holds(length) {
+			return false
+		}
+	}
+	return true
+}
+
+// branchLengths returns, for each note length, whether the branch condition matches it.
+func branchLengths(branch Branch) ([]bool, error) {
+	conditions, err := Input(branch.Condition).ParseBranchConditions()
+	if err != nil {
+		return nil, fmt.Errorf(`failed to parse condition of branch %s: "%s": %w`, branch.Id, branch.Condition, err)
+	}
+	result := make([]bool, len(NoteLengths))
+	for k, length := range NoteLengths {
+		for _, cond := range conditions {
+			if cond.Holds(length) {
+				result[k] = true
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// CoverageProblem is a note length that no branch of a composite sound matches (a gap) or
+// that more than one branch matches (an overlap).
+type CoverageProblem struct {
+	CompositeSoundId CompositeSoundId
+	Length           Constant
+	// Branches are the ids of the matching branches, in Order. It is empty for a gap.
+	Branches []BranchId
+}
+
+// Gap reports whether no branch matches the length.
+func (c CoverageProblem) Gap() bool {
+	return len(c.Branches) == 0
+}
+
+func (c CoverageProblem) String() string {
+	if c.Gap() {
+		return fmt.Sprintf("%s: no branch matches %s notes", c.CompositeSoundId, string(c.Length))
+	}
+	return fmt.Sprintf("%s: branches %s all match %s notes", c.CompositeSoundId, strings.Join(c.Branches, ", "), string(c.Length))
+}
+
+// AnalyzeCoverage reports every note length that the branches of a composite sound do not
+// match exactly once.
+func AnalyzeCoverage(compositeSound *CompositeSound) ([]CoverageProblem, error) {
+	matches := make([][]BranchId, len(NoteLengths))
+	for _, branch := range compositeSound.SortedBranches() {
+		lengths, err := branchLengths(branch)
+		if err != nil {
+			return nil, err
+		}
+		for k, match := range lengths {
+			if match {
+				matches[k] = append(matches[k], branch.Id)
+			}
+		}
+	}
+	result := make([]CoverageProblem, 0)
+	for k, branches := range matches {
+		if len(branches) != 1 {
+			result = append(result, CoverageProblem{
+				CompositeSoundId: compositeSound.Id,
+				Length:           NoteLengths[k],
+				Branches:         branches,
+			})
+		}
+	}
+	return result, nil
+}
+
+// AnalyzeCoverage analyzes every composite sound of the project in the order CreateCombos
+// emits them, which is the order Dorico evaluates their combinations. Composite sounds that
+// aren't assigned come last, in order of id.
+func (p *Project) AnalyzeCoverage() ([]CoverageProblem, error) {
+	ids := make([]CompositeSoundId, 0, len(p.CompositeSounds))
+	seen := make(map[CompositeSoundId]bool)
+	axes := p.SortedAxes()
+	size := GetSize(axes)
+	for k := 0; k < size; k++ {
+		id := p.Assignments[GetComboKey(axes, k)].Sound
+		if _, ok := p.CompositeSounds[id]; ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	unassigned := make([]CompositeSoundId, 0)
+	for id := range p.CompositeSounds {
+		if !seen[id] {
+			unassigned = append(unassigned, id)
+		}
+	}
+	sort.Strings(unassigned)
+	ids = append(ids, unassigned...)
+	result := make([]CoverageProblem, 0)
+	for _, id := range ids {
+		problems, err := AnalyzeCoverage(p.CompositeSounds[id])
+		if err != nil {
+			return nil, fmt.Errorf("failed to analyze %s: %w", p.CompositeSounds[id].Name, err)
+		}
+		result = append(result, problems...)
+	}
+	return result, nil
+}
+
+// lengthCondition writes a condition that matches exactly the lengths marked in lengths.
+func lengthCondition(lengths []bool) string {
+	last := len(NoteLengths) - 1
+	runs := make([]string, 0)
+	for k := 0; k <= last; k++ {
+		if !lengths[k] {
+			continue
+		}
+		j := k
+		for j < last && lengths[j+1] {
+			j++
+		}
+		lo, hi := string(NoteLengths[k]), string(NoteLengths[j])
+		switch {
+		case k == 0 && j == last:
+			return ""
+		case k == j:
+			runs = append(runs, fmt.Sprintf("nl == %s", lo))
+		case k == 0:
+			runs = append(runs, fmt.Sprintf("nl <= %s", hi))
+		case j == last:
+			runs = append(runs, fmt.Sprintf("nl >= %s", lo))
+		default:
+			runs = append(runs, fmt.Sprintf("%s <= nl <= %s", lo, hi))
+		}
+		k = j
+	}
+	return strings.Join(runs, " or ")
+}
+
+// FirstMatchWins rewrites the branches of a composite sound so that, taken in Order, each
+// matches only the note lengths that no earlier branch matches. Branches left with nothing
+// to match are dropped. The result has no overlaps; gaps remain gaps.
+func FirstMatchWins(compositeSound *CompositeSound) (*CompositeSound, error) {
+	result := *compositeSound
+	result.Branches = make(map[BranchId]Branch)
+	taken := make([]bool, len(NoteLengths))
+	for _, branch := range compositeSound.SortedBranches() {
+		lengths, err := branchLengths(branch)
+		if err != nil {
+			return nil, err
+		}
+		matched := false
+		for k := range lengths {
+			lengths[k] = lengths[k] && !taken[k]
+			taken[k] = taken[k] || lengths[k]
+			matched = matched || lengths[k]
+		}
+		if !matched {
+			continue
+		}
+		branch.Condition = lengthCondition(lengths)
+		result.Branches[branch.Id] = branch
+	}
+	return &result, nil
+}
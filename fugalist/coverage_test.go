@@ -0,0 +1,134 @@
+package fugalist
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func compositeWith(conditions ...string) *CompositeSound {
+	compositeSound := &CompositeSound{Id: "cs", Name: "cs", Branches: map[BranchId]Branch{}}
+	for k, cond := range conditions {
+		id := string(rune('a' + k))
+		compositeSound.Branches[id] = Branch{Id: id, Order: float64(k + 1), Condition: cond}
+	}
+	return compositeSound
+}
+
+func TestAnalyzeCoverage(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []string
+		expected   []CoverageProblem
+	}{
+		{"exact", []string{"nl < medium", "nl >= medium"}, []CoverageProblem{}},
+		{"unconditional", []string{""}, []CoverageProblem{}},
+		{"gap", []string{"nl < medium", "nl > medium"}, []CoverageProblem{
+			{"cs", Medium, nil},
+		}},
+		{"overlap", []string{"nl <= short", "short <= nl < long", "nl >= long"}, []CoverageProblem{
+			{"cs", Short, []BranchId{"a", "b"}},
+		}},
+		{"both", []string{"nl < veryLong", "nl == short"}, []CoverageProblem{
+			{"cs", Short, []BranchId{"a", "b"}},
+			{"cs", VeryLong, nil},
+		}},
+		{"disjunction", []string{"nl == short or nl == long", "not (nl == short or nl == long)"}, []CoverageProblem{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, err := AnalyzeCoverage(compositeWith(test.conditions...))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, problems)
+		})
+	}
+}
+
+func TestAnalyzeCoverage_BadCondition(t *testing.T) {
+	_, err := AnalyzeCoverage(compositeWith("nl < sorta"))
+	assert.NotNil(t, err)
+}
+
+func TestProject_AnalyzeCoverage(t *testing.T) {
+	problems, err := ReadProject(t, "ParseTest1").AnalyzeCoverage()
+	assert.Nil(t, err)
+	for _, problem := range problems {
+		assert.NotEmpty(t, problem.String())
+	}
+}
+
+func TestProject_AnalyzeCoverage_Order(t *testing.T) {
+	first := compositeWith("nl < medium")
+	first.Id = "z"
+	second := compositeWith("nl > medium")
+	second.Id = "y"
+	unassigned := compositeWith("nl == medium")
+	unassigned.Id = "a"
+	project := &Project{
+		Axes: map[string]Axis{axis2.Id: axis2},
+		CompositeSounds: map[CompositeSoundId]*CompositeSound{
+			first.Id: first, second.Id: second, unassigned.Id: unassigned,
+		},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: first.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: second.Id},
+		},
+	}
+	problems, err := project.AnalyzeCoverage()
+	assert.Nil(t, err)
+	ids := make([]CompositeSoundId, 0)
+	for _, problem := range problems {
+		if len(ids) == 0 || ids[len(ids)-1] != problem.CompositeSoundId {
+			ids = append(ids, problem.CompositeSoundId)
+		}
+	}
+	assert.Equal(t, []CompositeSoundId{"z", "y", "a"}, ids)
+}
+
+func TestFirstMatchWins(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []string
+		expected   map[BranchId]string
+	}{
+		{"already disjoint", []string{"nl < medium", "nl >= medium"}, map[BranchId]string{
+			"a": "nl <= short",
+			"b": "nl >= medium",
+		}},
+		{"overlap", []string{"nl <= medium", "nl >= short"}, map[BranchId]string{
+			"a": "nl <= medium",
+			"b": "nl >= long",
+		}},
+		{"hole in the middle", []string{"nl == medium", ""}, map[BranchId]string{
+			"a": "nl == medium",
+			"b": "nl <= short or nl >= long",
+		}},
+		{"inner range", []string{"nl == veryShort or nl == veryLong", ""}, map[BranchId]string{
+			"a": "nl == veryShort or nl == veryLong",
+			"b": "short <= nl <= long",
+		}},
+		{"split", []string{"nl == veryShort or nl == veryLong", "nl != medium"}, map[BranchId]string{
+			"a": "nl == veryShort or nl == veryLong",
+			"b": "nl == short or nl == long",
+		}},
+		{"unreachable", []string{"", "nl == short"}, map[BranchId]string{
+			"a": "",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rewritten, err := FirstMatchWins(compositeWith(test.conditions...))
+			assert.Nil(t, err)
+			actual := make(map[BranchId]string)
+			for id, branch := range rewritten.Branches {
+				actual[id] = branch.Condition
+			}
+			assert.Equal(t, test.expected, actual)
+
+			problems, err := AnalyzeCoverage(rewritten)
+			assert.Nil(t, err)
+			for _, problem := range problems {
+				assert.True(t, problem.Gap())
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package fugalist
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"strconv"
+)
+
+// Cubase stores an expression map as a tree of generic elements (<obj>, <member>, <list>,
+// <int>, <float>, <string>) told apart by their attributes.
+type cubaseNode struct {
+	XMLName xml.Name
+	Class   string        `xml:"class,attr,omitempty"`
+	Name    string        `xml:"name,attr,omitempty"`
+	ID      string        `xml:"ID,attr,omitempty"`
+	Value   string        `xml:"value,attr,omitempty"`
+	Type    string        `xml:"type,attr,omitempty"`
+	Wide    string        `xml:"wide,attr,omitempty"`
+	Nodes   []*cubaseNode `xml:",any"`
+}
+
+func cubaseInt(name string, value int) *cubaseNode {
+	return &cubaseNode{XMLName: xml.Name{Local: "int"}, Name: name, Value: strconv.Itoa(value)}
+}
+
+func cubaseFloat(name string, value float64) *cubaseNode {
+	return &cubaseNode{XMLName: xml.Name{Local: "float"}, Name: name, Value: strconv.FormatFloat(value, 'f', -1, 64)}
+}
+
+func cubaseString(name string, value string) *cubaseNode {
+	return &cubaseNode{XMLName: xml.Name{Local: "string"}, Name: name, Value: value, Wide: "true"}
+}
+
+// Cubase list ownership: a list either owns its objects or refers to objects owned elsewhere.
+const (
+	cubaseOwned      = 1
+	cubaseReferenced = 2
+)
+
+// cubaseList returns <member name=...> holding a <list> of objects with the given ownership.
+// Cubase names the list itself "obj" if it owns its objects and "s" if it refers to them.
+func cubaseList(name string, ownership int, objs ...*cubaseNode) *cubaseNode {
+	listName := "obj"
+	if ownership == cubaseReferenced {
+		listName = "s"
+	}
+	return &cubaseNode{
+		XMLName: xml.Name{Local: "member"},
+		Name:    name,
+		Nodes: []*cubaseNode{
+			cubaseInt("ownership", ownership),
+			{XMLName: xml.Name{Local: "list"}, Name: listName, Type: "obj", Nodes: objs},
+		},
+	}
+}
+
+// cubaseIds hands out the object IDs Cubase uses to cross-reference objects.
+type cubaseIds int
+
+func (ids *cubaseIds) obj(class string, name string, nodes ...*cubaseNode) *cubaseNode {
+	*ids++
+	return &cubaseNode{XMLName: xml.Name{Local: "obj"}, Class: class, Name: name, ID: strconv.Itoa(int(*ids)), Nodes: nodes}
+}
+
+const (
+	cubaseNoteOn        = 144
+	cubaseControlChange = 176
+	cubaseProgramChange = 192
+	cubasePressure      = 208
+	cubasePitchBend     = 224
+)
+
+// Cubase has four articulation groups.
+const cubaseGroups = 4
+
+// Cubase articulation types.
+const (
+	cubaseDirection = 0
+	cubaseAttribute = 1
+)
+
+// CubaseOutputEvent converts a Dorico switch action into Cubase's status and data bytes.
+func CubaseOutputEvent(action doricolib.SwitchAction) (status int, data1 int, data2 int, err error) {
+	switch action.Type {
+	case "kKeySwitch":
+		status = cubaseNoteOn
+	case "kControlChange":
+		status = cubaseControlChange
+	case "kProgramChange":
+		status = cubaseProgramChange
+	case ActionChannelPressure:
+		status = cubasePressure
+	case ActionPitchBend:
+		bend, err := strconv.Atoi(action.Param1)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("bad %s parameter: %s", action.Type, action.Param1)
+		}
+		return cubasePitchBend, bend & 127, bend >> 7, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("no Cubase equivalent for %s", action.Type)
+	}
+	data1, err = strconv.Atoi(action.Param1)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("bad %s parameter: %s", action.Type, action.Param1)
+	}
+	if action.Param2 != "" {
+		data2, err = strconv.Atoi(action.Param2)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("bad %s parameter: %s", action.Type, action.Param2)
+		}
+	}
+	return status, data1, data2, nil
+}
+
+// cubaseChannel separates an absolute channel change, which Cubase makes a property of the
+// slot, from the MIDI messages the slot sends. The channel is -1 if there is none.
+func cubaseChannel(actions []doricolib.SwitchAction) (int, []doricolib.SwitchAction, error) {
+	channel, messages, relative, err := channelChange(actions)
+	if err != nil {
+		return -1, nil, err
+	}
+	if relative {
+		return -1, nil, fmt.Errorf("no Cubase equivalent for %s", ActionRelativeChannel)
+	}
+	return channel, messages, nil
+}
+
+func cubaseMidiMessages(ids *cubaseIds, actions []doricolib.SwitchAction) (*cubaseNode, error) {
+	events := make([]*cubaseNode, len(actions))
+	for k, action := range actions {
+		status, data1, data2, err := CubaseOutputEvent(action)
+		if err != nil {
+			return nil, err
+		}
+		events[k] = ids.obj("POutputEvent", "",
+			cubaseInt("status", status),
+			cubaseInt("data1", data1),
+			cubaseInt("data2", data2),
+		)
+	}
+	return cubaseList("midiMessages", cubaseOwned, events...), nil
+}
+
+// cubaseNoteChanger carries the velocity range, pitch range, transposition and length
+// factor of a combination.
+func cubaseNoteChanger(ids *cubaseIds, combo *doricolib.PlayingTechniqueCombination) (*cubaseNode, error) {
+	minVelocity, maxVelocity, err := splitRange(combo.VelocityRange)
+	if err != nil {
+		return nil, fmt.Errorf("bad velocity range: %w", err)
+	}
+	minPitch, maxPitch, err := splitRange(combo.PitchRange)
+	if err != nil {
+		return nil, fmt.Errorf("bad pitch range: %w", err)
+	}
+	lengthFactor := 1.0
+	if combo.Flags&FlagLengthFactor != 0 {
+		lengthFactor, err = strconv.ParseFloat(combo.LengthFactor, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad length factor: %s", combo.LengthFactor)
+		}
+	}
+	velocityFactor := 1.0
+	if combo.VelocityFactor != "" {
+		velocityFactor, err = strconv.ParseFloat(combo.VelocityFactor, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad velocity factor: %s", combo.VelocityFactor)
+		}
+	}
+	changer := ids.obj("PSlotNoteChanger", "",
+		cubaseInt("channel", -1),
+		cubaseFloat("velocityFact", velocityFactor),
+		cubaseFloat("lengthFact", lengthFactor),
+		cubaseInt("minVelocity", minVelocity),
+		cubaseInt("maxVelocity", maxVelocity),
+		cubaseInt("transpose", combo.Transpose),
+		cubaseInt("minPitch", minPitch),
+		cubaseInt("maxPitch", maxPitch),
+	)
+	return cubaseList("noteChanger", cubaseOwned, changer), nil
+}
+
+func cubaseSlot(ids *cubaseIds, name string, visuals []*cubaseNode, actions []doricolib.SwitchAction, combo *doricolib.PlayingTechniqueCombination) (*cubaseNode, error) {
+	channel, actions, err := cubaseChannel(actions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slot %s: %w", name, err)
+	}
+	messages, err := cubaseMidiMessages(ids, actions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slot %s: %w", name, err)
+	}
+	changer, err := cubaseNoteChanger(ids, combo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slot %s: %w", name, err)
+	}
+	refs := make([]*cubaseNode, len(visuals))
+	for k, visual := range visuals {
+		refs[k] = &cubaseNode{XMLName: xml.Name{Local: "obj"}, Class: visual.Class, ID: visual.ID}
+	}
+	return ids.obj("PSoundSlot", "",
+		ids.obj("PSlotThruTrigger", "remote",
+			cubaseInt("status", cubaseNoteOn),
+			cubaseInt("data1", -1),
+		),
+		ids.obj("PSlotMidiAction", "action",
+			cubaseInt("version", 600),
+			changer,
+			messages,
+			cubaseInt("channel", channel),
+		),
+		cubaseList("sv", cubaseReferenced, refs...),
+		&cubaseNode{XMLName: xml.Name{Local: "member"}, Name: "name", Nodes: []*cubaseNode{cubaseString("s", name)}},
+		cubaseInt("color", 0),
+	), nil
+}
+
+// cubaseVisuals creates the articulation (USlotVisuals) for a technique or tint.
+func cubaseVisuals(ids *cubaseIds, name string, articulationType int, group int) *cubaseNode {
+	return ids.obj("USlotVisuals", "",
+		cubaseInt("displaytype", 1),
+		cubaseInt("articulationtype", articulationType),
+		cubaseInt("symbol", -1),
+		cubaseString("text", name),
+		cubaseString("description", name),
+		cubaseInt("group", group),
+	)
+}
+
+// CreateCubaseExpressionMap creates a Cubase expression map (.expressionmap) for the project.
+// Each assigned combination becomes a sound slot whose articulations are the combination's
+// techniques, grouped by axis. Composite sounds play their first branch. Each tint becomes a
+// direction with a slot of its own.
+func (p *Project) CreateCubaseExpressionMap(summary ProjectSummary) ([]byte, error) {
+	articulations, err := p.Articulations()
+	if err != nil {
+		return nil, err
+	}
+	var ids cubaseIds
+	visuals := make([]*cubaseNode, 0)
+	visualsByTechnique := make(map[TechniqueId]*cubaseNode)
+	slots := make([]*cubaseNode, 0)
+
+	for _, articulation := range articulations {
+		slotVisuals := make([]*cubaseNode, 0)
+		for k, technique := range articulation.Techniques {
+			group := articulation.Groups[k]
+			if group >= cubaseGroups {
+				return nil, fmt.Errorf("%s: Cubase supports at most %d articulation groups", technique.Name, cubaseGroups)
+			}
+			visual, exists := visualsByTechnique[technique.Id]
+			if !exists {
+				visual = cubaseVisuals(&ids, technique.Name, cubaseAttribute, group)
+				visualsByTechnique[technique.Id] = visual
+				visuals = append(visuals, visual)
+			}
+			slotVisuals = append(slotVisuals, visual)
+		}
+		slot, err := cubaseSlot(&ids, articulation.Name, slotVisuals, articulation.Combo.SwitchOnActions.SwitchOnActions, articulation.Combo)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+
+	for _, tint := range p.SortedTints() {
+		actions, err := p.TintActions(tint)
+		if err != nil {
+			return nil, err
+		}
+		visual := cubaseVisuals(&ids, tint.Name, cubaseDirection, 0)
+		visuals = append(visuals, visual)
+		slot, err := cubaseSlot(&ids, tint.Name, []*cubaseNode{visual}, actions, &doricolib.PlayingTechniqueCombination{
+			VelocityRange: "0,127",
+			PitchRange:    "0,127",
+		})
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+
+	root := &cubaseNode{
+		XMLName: xml.Name{Local: "InstrumentMap"},
+		Nodes: []*cubaseNode{
+			{XMLName: xml.Name{Local: "string"}, Name: "name", Value: summary.Name},
+			cubaseList("slotvisuals", cubaseOwned, visuals...),
+			cubaseList("slots", cubaseOwned, slots...),
+			cubaseInt("controller", 0),
+		},
+	}
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&out)
+	encoder.Indent("", "   ")
+	err = encoder.Encode(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Cubase expression map: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// GenerateCubaseExpressionMap reads a project and its summary from store and creates a
+// Cubase expression map for it.
+func GenerateCubaseExpressionMap(ctx context.Context, store Store, pid string) ([]byte, error) {
+	project, projectSummary, err := readProjectAndSummary(ctx, store, pid)
+	if err != nil {
+		return nil, err
+	}
+	return project.CreateCubaseExpressionMap(*projectSummary)
+}
@@ -0,0 +1,318 @@
+package fugalist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// child returns the first child of n with the given name attribute.
+func (n *cubaseNode) child(name string) *cubaseNode {
+	for _, c := range n.Nodes {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// objs returns the objects in the list of member name, or nil if there is no such member.
+// The list is the member's <list> element, whatever its own name: Cubase calls it "obj" or
+// "s" depending on its ownership.
+func (n *cubaseNode) objs(name string) []*cubaseNode {
+	member := n.child(name)
+	if member == nil {
+		return nil
+	}
+	for _, c := range member.Nodes {
+		if c.XMLName.Local == "list" {
+			return c.Nodes
+		}
+	}
+	return nil
+}
+
+func (n *cubaseNode) intValue(name string, def int) (int, error) {
+	c := n.child(name)
+	if c == nil {
+		return def, nil
+	}
+	v, err := strconv.Atoi(c.Value)
+	if err != nil {
+		return 0, fmt.Errorf("bad value for %s: %s", name, c.Value)
+	}
+	return v, nil
+}
+
+func (n *cubaseNode) floatValue(name string, def float64) (float64, error) {
+	c := n.child(name)
+	if c == nil {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(c.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad value for %s: %s", name, c.Value)
+	}
+	return v, nil
+}
+
+func (n *cubaseNode) stringValue(name string) string {
+	c := n.child(name)
+	if c == nil {
+		return ""
+	}
+	return c.Value
+}
+
+// collectVisuals indexes every USlotVisuals definition in the tree by ID. Cubase writes an
+// articulation in full once and refers to it by ID elsewhere.
+func collectVisuals(n *cubaseNode, visuals map[string]*cubaseNode) {
+	if n.Class == "USlotVisuals" && len(n.Nodes) > 0 {
+		visuals[n.ID] = n
+	}
+	for _, c := range n.Nodes {
+		collectVisuals(c, visuals)
+	}
+}
+
+// CubaseSwitchAction converts a Cubase output event into a Dorico switch action.
+func CubaseSwitchAction(status int, data1 int, data2 int) (doricolib.SwitchAction, error) {
+	p1 := strconv.Itoa(data1)
+	p2 := strconv.Itoa(data2)
+	switch status & 0xF0 {
+	case cubaseNoteOn:
+		return doricolib.SwitchAction{Type: "kKeySwitch", Param1: p1, Param2: p2}, nil
+	case cubaseControlChange:
+		return doricolib.SwitchAction{Type: "kControlChange", Param1: p1, Param2: p2}, nil
+	case cubaseProgramChange:
+		return doricolib.SwitchAction{Type: "kProgramChange", Param1: p1, Param2: "0"}, nil
+	case cubasePressure:
+		return doricolib.SwitchAction{Type: ActionChannelPressure, Param1: p1}, nil
+	case cubasePitchBend:
+		return doricolib.SwitchAction{Type: ActionPitchBend, Param1: strconv.Itoa(data2<<7 | data1)}, nil
+	default:
+		return doricolib.SwitchAction{}, fmt.Errorf("unsupported output event status %d", status)
+	}
+}
+
+// techniqueByName finds the Dorico technique whose name matches, ignoring case.
+func techniqueByName(name string) (doricolib.Technique, bool) {
+	for _, technique := range doricolib.Techniques {
+		if strings.EqualFold(technique.Name, strings.TrimSpace(name)) {
+			return technique, true
+		}
+	}
+	return doricolib.Technique{}, false
+}
+
+func cubaseActions(action *cubaseNode) ([]doricolib.SwitchAction, error) {
+	result := make([]doricolib.SwitchAction, 0)
+	channel, err := action.intValue("channel", -1)
+	if err != nil {
+		return nil, err
+	}
+	if channel >= 0 {
+		result = append(result, doricolib.SwitchAction{Type: ActionAbsoluteChannel, Param1: strconv.Itoa(channel)})
+	}
+	for _, event := range action.objs("midiMessages") {
+		status, err := event.intValue("status", 0)
+		if err != nil {
+			return nil, err
+		}
+		data1, err := event.intValue("data1", 0)
+		if err != nil {
+			return nil, err
+		}
+		data2, err := event.intValue("data2", 0)
+		if err != nil {
+			return nil, err
+		}
+		switchAction, err := CubaseSwitchAction(status, data1, data2)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, switchAction)
+	}
+	return result, nil
+}
+
+// cubasePlayData converts the action of a sound slot into PlayData.
+func cubasePlayData(action *cubaseNode) (PlayData, error) {
+	actions, err := cubaseActions(action)
+	if err != nil {
+		return PlayData{}, err
+	}
+	on, err := FormatMidiEvents(actions)
+	if err != nil {
+		return PlayData{}, err
+	}
+	playData := PlayData{
+		On:    on,
+		Dyn:   "velocity",
+		Trans: "0",
+	}
+	changers := action.objs("noteChanger")
+	if len(changers) == 0 {
+		return playData, nil
+	}
+	changer := changers[0]
+	minVelocity, err := changer.intValue("minVelocity", 0)
+	if err != nil {
+		return PlayData{}, err
+	}
+	maxVelocity, err := changer.intValue("maxVelocity", 127)
+	if err != nil {
+		return PlayData{}, err
+	}
+	transpose, err := changer.intValue("transpose", 0)
+	if err != nil {
+		return PlayData{}, err
+	}
+	lengthFactor, err := changer.floatValue("lengthFact", 1)
+	if err != nil {
+		return PlayData{}, err
+	}
+	velocityFactor, err := changer.floatValue("velocityFact", 1)
+	if err != nil {
+		return PlayData{}, err
+	}
+	minPitch, err := changer.intValue("minPitch", 0)
+	if err != nil {
+		return PlayData{}, err
+	}
+	maxPitch, err := changer.intValue("maxPitch", 127)
+	if err != nil {
+		return PlayData{}, err
+	}
+	playData.Dyn = FormatMidiDynamic(doricolib.VolumeType{Type: "kNoteVelocity", Param1: "0"}, fmt.Sprintf("%d,%d", minVelocity, maxVelocity))
+	playData.Trans = FormatTranspose(transpose)
+	playData.Pitch = FormatPitchRange(fmt.Sprintf("%d,%d", minPitch, maxPitch))
+	if velocityFactor != 1 {
+		playData.VelFactor = velocityFactor
+	}
+	if lengthFactor != 1 {
+		playData.Len = FormatLengthFactor(strconv.FormatFloat(lengthFactor, 'f', -1, 64), 1)
+	}
+	return playData, nil
+}
+
+// ImportCubaseExpressionMap converts a Cubase expression map (.expressionmap) into a new
+// Fugalist project and its summary. Each sound slot whose articulations are attributes
+// becomes an assigned combination; a slot with a single direction becomes a Tint.
+// Articulations are matched to Dorico techniques by description, then by text. A slot with
+// an articulation that matches none is left out, with a warning naming the articulation.
+func ImportCubaseExpressionMap(data []byte) (*Project, *ProjectSummary, Warnings, error) {
+	root := &cubaseNode{}
+	err := xml.Unmarshal(data, root)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse Cubase expression map: %w", err)
+	}
+	if root.XMLName.Local != "InstrumentMap" {
+		return nil, nil, nil, fmt.Errorf("not a Cubase expression map: <%s>", root.XMLName.Local)
+	}
+	visuals := make(map[string]*cubaseNode)
+	collectVisuals(root, visuals)
+
+	ptMap := make(PtMap)
+	tints := make(map[string]*Tint)
+	// unmatched lists the articulations with no Dorico technique, in the order found, and
+	// the slots they keep out.
+	unmatched := make([]string, 0)
+	skipped := make(map[string][]string)
+	for k, slot := range root.objs("slots") {
+		name := ""
+		if member := slot.child("name"); member != nil {
+			name = member.stringValue("s")
+		}
+		action := slot.child("action")
+		if action == nil {
+			return nil, nil, nil, fmt.Errorf("slot %s has no action", name)
+		}
+
+		ids := make([]string, 0)
+		var direction *doricolib.Technique = nil
+		matched := true
+		for _, ref := range slot.objs("sv") {
+			visual, ok := visuals[ref.ID]
+			if !ok {
+				return nil, nil, nil, fmt.Errorf("slot %s refers to unknown articulation %s", name, ref.ID)
+			}
+			technique, ok := techniqueByName(visual.stringValue("description"))
+			if !ok {
+				technique, ok = techniqueByName(visual.stringValue("text"))
+			}
+			if !ok {
+				text := visual.stringValue("text")
+				if _, seen := skipped[text]; !seen {
+					unmatched = append(unmatched, text)
+				}
+				skipped[text] = append(skipped[text], name)
+				matched = false
+				continue
+			}
+			articulationType, err := visual.intValue("articulationtype", cubaseAttribute)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if articulationType == cubaseDirection {
+				direction = &technique
+			}
+			ids = append(ids, technique.Id)
+		}
+		if !matched {
+			continue
+		}
+
+		if direction != nil && len(ids) == 1 {
+			actions, err := cubaseActions(action)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("slot %s: %w", name, err)
+			}
+			midi, err := FormatMidiEvents(actions)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("slot %s: %w", name, err)
+			}
+			tint := &Tint{
+				Id:    Uniq(),
+				Order: 100 * (len(tints) + 1),
+				Name:  direction.Name,
+				Midi:  midi,
+			}
+			tints[tint.Id] = tint
+			continue
+		}
+
+		combo := "pt.natural"
+		if len(ids) > 0 {
+			sort.Strings(ids)
+			combo = strings.Join(ids, "+")
+		}
+		if _, exists := ptMap[combo]; exists {
+			// Cubase would play the first matching slot.
+			continue
+		}
+		playData, err := cubasePlayData(action)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("slot %d (%s): %w", k, name, err)
+		}
+		ptMap[combo] = BrMap{"": playData}
+	}
+
+	project, err := BuildProject(ptMap)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	project.Tints = tints
+	summary := &ProjectSummary{
+		ProjectID: project.ProjectId,
+		Name:      root.stringValue("name"),
+	}
+	var warnings Warnings
+	for _, text := range unmatched {
+		warnings.add("no Dorico technique for articulation %q; left out slots %s", text, strings.Join(skipped[text], ", "))
+	}
+	return project, summary, warnings, nil
+}
@@ -0,0 +1,338 @@
+package fugalist
+
+import (
+	"encoding/xml"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+func TestCubaseOutputEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   doricolib.SwitchAction
+		expected []int
+		err      bool
+	}{
+		{"KS", doricolib.SwitchAction{Type: "kKeySwitch", Param1: "24", Param2: "100"}, []int{144, 24, 100}, false},
+		{"CC", doricolib.SwitchAction{Type: "kControlChange", Param1: "1", Param2: "64"}, []int{176, 1, 64}, false},
+		{"PC", doricolib.SwitchAction{Type: "kProgramChange", Param1: "7", Param2: "0"}, []int{192, 7, 0}, false},
+		{"pitch bend", doricolib.SwitchAction{Type: ActionPitchBend, Param1: "9000"}, []int{224, 40, 70}, false},
+		{"channel pressure", doricolib.SwitchAction{Type: ActionChannelPressure, Param1: "90"}, []int{208, 90, 0}, false},
+		{"unknown", doricolib.SwitchAction{Type: "kBogus", Param1: "7"}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, data1, data2, err := CubaseOutputEvent(test.action)
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expected, []int{status, data1, data2})
+			}
+		})
+	}
+}
+
+func TestCreateCubaseExpressionMap(t *testing.T) {
+	project := ReadProject(t, "ParseTest1")
+	tint := &Tint{Id: Uniq(), Order: 1, Name: "Accent", Midi: "CC20=127"}
+	project.Tints = map[string]*Tint{tint.Id: tint}
+	articulations, err := project.Articulations()
+	assert.Nil(t, err)
+
+	data, err := project.CreateCubaseExpressionMap(ProjectSummary{Name: "ParseTest1"})
+	assert.Nil(t, err)
+	root := &cubaseNode{}
+	err = xml.Unmarshal(data, root)
+	assert.Nil(t, err)
+	assert.Equal(t, "InstrumentMap", root.XMLName.Local)
+
+	slots := root.objs("slots")
+	assert.Equal(t, len(articulations)+1, len(slots))
+	for k, articulation := range articulations {
+		visuals := slots[k].objs("sv")
+		assert.Equal(t, len(articulation.Techniques), len(visuals))
+		events := slots[k].child("action").objs("midiMessages")
+		assert.Equal(t, len(articulation.Combo.SwitchOnActions.SwitchOnActions), len(events))
+	}
+
+	accent := slots[len(slots)-1].child("action").objs("midiMessages")
+	assert.Equal(t, 1, len(accent))
+	assert.Equal(t, "176", accent[0].stringValue("status"))
+	assert.Equal(t, "20", accent[0].stringValue("data1"))
+	assert.Equal(t, "127", accent[0].stringValue("data2"))
+}
+
+func TestCreateCubaseExpressionMap_TooManyGroups(t *testing.T) {
+	sound := &VstSound{Id: Uniq(), Name: "x", Midi: "KS1"}
+	project := &Project{
+		Axes:        map[string]Axis{},
+		VstSounds:   map[VstSoundId]*VstSound{sound.Id: sound},
+		Assignments: map[string]Assignment{},
+	}
+	names := []string{"Staccato", "Legato", "Non vibrato", "Marcato", "Pizzicato"}
+	ids := make([]string, len(names))
+	for k, name := range names {
+		axis := Axis{Id: Uniq(), Name: name, SortOrder: float64(k), Techniques: []Technique{
+			{Id: Uniq(), Name: "Normal"},
+			{Id: Uniq(), Name: name},
+		}}
+		project.Axes[axis.Id] = axis
+		ids[k] = axis.Techniques[0].Id
+	}
+	ids[len(ids)-1] = project.SortedAxes()[len(ids)-1].Techniques[1].Id
+	project.Assignments[Xor(ids)] = Assignment{Sound: sound.Id}
+	_, err := project.CreateCubaseExpressionMap(ProjectSummary{})
+	assert.NotNil(t, err)
+}
+
+func TestCreateCubaseExpressionMap_TooManyGroupsLaterTechnique(t *testing.T) {
+	sound := &VstSound{Id: Uniq(), Name: "x", Midi: "KS1"}
+	project := &Project{
+		Axes:        map[string]Axis{},
+		VstSounds:   map[VstSoundId]*VstSound{sound.Id: sound},
+		Assignments: map[string]Assignment{},
+	}
+	names := []string{"Staccato", "Legato", "Non vibrato", "Marcato", "Pizzicato"}
+	for k, name := range names {
+		axis := Axis{Id: Uniq(), Name: name, SortOrder: float64(k), Techniques: []Technique{
+			{Id: Uniq(), Name: "Normal"},
+			{Id: Uniq(), Name: name},
+		}}
+		project.Axes[axis.Id] = axis
+	}
+	axes := project.SortedAxes()
+	ids := make([]string, len(axes))
+	for k, axis := range axes {
+		ids[k] = axis.Techniques[0].Id
+	}
+	// The first technique is in group 0; only the second is out of Cubase's range.
+	ids[0] = axes[0].Techniques[1].Id
+	ids[len(ids)-1] = axes[len(axes)-1].Techniques[1].Id
+	project.Assignments[Xor(ids)] = Assignment{Sound: sound.Id}
+	_, err := project.CreateCubaseExpressionMap(ProjectSummary{})
+	assert.NotNil(t, err)
+}
+
+func TestCreateCubaseExpressionMap_GroupPerTechnique(t *testing.T) {
+	sound := &VstSound{Id: Uniq(), Name: "x", Midi: "KS1"}
+	project := &Project{
+		Axes:      map[string]Axis{axis1.Id: axis1, axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{sound.Id: sound},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis1.Techniques[1].Id, axis2.Techniques[1].Id}): {Sound: sound.Id},
+		},
+	}
+	data, err := project.CreateCubaseExpressionMap(ProjectSummary{Name: "groups"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	root := &cubaseNode{}
+	err = xml.Unmarshal(data, root)
+	assert.Nil(t, err)
+	groups := make(map[string]string)
+	for _, visual := range root.objs("slotvisuals") {
+		groups[visual.stringValue("text")] = visual.stringValue("group")
+	}
+	expected := make(map[string]string)
+	for k, axis := range project.SortedAxes() {
+		expected[axis.Techniques[1].Name] = strconv.Itoa(k)
+	}
+	assert.Equal(t, expected, groups)
+
+	// Owned lists are named "obj" and references "s", as Cubase writes them.
+	assert.Equal(t, "obj", root.child("slots").Nodes[1].Name)
+	slot := root.objs("slots")[0]
+	assert.Equal(t, "s", slot.child("sv").Nodes[1].Name)
+	assert.Equal(t, "obj", slot.child("action").child("midiMessages").Nodes[1].Name)
+}
+
+func TestCubaseSwitchAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    []int
+		expected doricolib.SwitchAction
+		err      bool
+	}{
+		{"note", []int{144, 24, 100}, doricolib.SwitchAction{Type: "kKeySwitch", Param1: "24", Param2: "100"}, false},
+		{"note on channel 2", []int{145, 24, 100}, doricolib.SwitchAction{Type: "kKeySwitch", Param1: "24", Param2: "100"}, false},
+		{"CC", []int{176, 1, 64}, doricolib.SwitchAction{Type: "kControlChange", Param1: "1", Param2: "64"}, false},
+		{"PC", []int{192, 7, 0}, doricolib.SwitchAction{Type: "kProgramChange", Param1: "7", Param2: "0"}, false},
+		{"pitch bend", []int{224, 0, 64}, doricolib.SwitchAction{Type: ActionPitchBend, Param1: "8192"}, false},
+		{"channel pressure", []int{208, 90, 0}, doricolib.SwitchAction{Type: ActionChannelPressure, Param1: "90"}, false},
+		{"poly pressure", []int{160, 24, 90}, doricolib.SwitchAction{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action, err := CubaseSwitchAction(test.event[0], test.event[1], test.event[2])
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expected, action)
+			}
+		})
+	}
+}
+
+func articulationsByName(t *testing.T, p *Project) map[string]string {
+	articulations, err := p.Articulations()
+	assert.Nil(t, err)
+	result := make(map[string]string)
+	for _, articulation := range articulations {
+		on, err := FormatMidiEvents(articulation.Combo.SwitchOnActions.SwitchOnActions)
+		assert.Nil(t, err)
+		result[articulation.Name] = on
+	}
+	return result
+}
+
+func TestImportCubaseExpressionMap(t *testing.T) {
+	project := ReadProject(t, "ParseTest1")
+	// Cubase plays a single branch of a composite sound; keep only that one.
+	for _, compositeSound := range project.CompositeSounds {
+		var first Branch
+		for _, branch := range compositeSound.Branches {
+			if first.Id == "" || branch.Order < first.Order {
+				first = branch
+			}
+		}
+		compositeSound.Branches = map[BranchId]Branch{first.Id: first}
+	}
+	tint := &Tint{Id: Uniq(), Order: 1, Name: "Accent", Midi: "CC20=127"}
+	project.Tints = map[string]*Tint{tint.Id: tint}
+	data, err := project.CreateCubaseExpressionMap(ProjectSummary{Name: "ParseTest1"})
+	assert.Nil(t, err)
+
+	imported, summary, warnings, err := ImportCubaseExpressionMap(data)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Empty(t, warnings)
+	assert.Equal(t, "ParseTest1", summary.Name)
+	assert.Equal(t, articulationsByName(t, project), articulationsByName(t, imported))
+	assert.Equal(t, 1, len(imported.Tints))
+	for _, tint := range imported.Tints {
+		assert.Equal(t, "Accent", tint.Name)
+		assert.Equal(t, "CC20=127", tint.Midi)
+	}
+}
+
+func TestCubaseExpressionMap_Channel(t *testing.T) {
+	project := ReadProject(t, "ParseTest1")
+	tint := &Tint{Id: Uniq(), Order: 1, Name: "Accent", Midi: "CH3, CC20=127"}
+	project.Tints = map[string]*Tint{tint.Id: tint}
+	data, err := project.CreateCubaseExpressionMap(ProjectSummary{Name: "ParseTest1"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	root := &cubaseNode{}
+	err = xml.Unmarshal(data, root)
+	assert.Nil(t, err)
+	slots := root.objs("slots")
+	action := slots[len(slots)-1].child("action")
+	assert.Equal(t, "2", action.stringValue("channel"))
+	assert.Equal(t, 1, len(action.objs("midiMessages")))
+
+	imported, _, _, err := ImportCubaseExpressionMap(data)
+	if !assert.Nil(t, err) {
+		return
+	}
+	for _, tint := range imported.Tints {
+		assert.Equal(t, "CH3, CC20=127", tint.Midi)
+	}
+
+	tint.Midi = "CH+1"
+	_, err = project.CreateCubaseExpressionMap(ProjectSummary{Name: "ParseTest1"})
+	assert.NotNil(t, err)
+}
+
+func TestImportCubaseExpressionMap_UnknownArticulation(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<InstrumentMap>
+   <string name="name" value="Bad"/>
+   <member name="slots">
+      <int name="ownership" value="1"/>
+      <list name="slots" type="obj">
+         <obj class="PSoundSlot" ID="1">
+            <member name="name">
+               <string name="s" value="odd" wide="true"/>
+            </member>
+            <obj class="PSlotMidiAction" name="action" ID="2"/>
+            <member name="sv">
+               <int name="ownership" value="2"/>
+               <list name="sv" type="obj">
+                  <obj class="USlotVisuals" ID="3">
+                     <int name="articulationtype" value="1"/>
+                     <string name="text" value="wibble" wide="true"/>
+                  </obj>
+               </list>
+            </member>
+         </obj>
+         <obj class="PSoundSlot" ID="4">
+            <member name="name">
+               <string name="s" value="short" wide="true"/>
+            </member>
+            <obj class="PSlotMidiAction" name="action" ID="5"/>
+            <member name="sv">
+               <int name="ownership" value="2"/>
+               <list name="sv" type="obj">
+                  <obj class="USlotVisuals" ID="6">
+                     <int name="articulationtype" value="1"/>
+                     <string name="text" value="Staccato" wide="true"/>
+                  </obj>
+               </list>
+            </member>
+         </obj>
+         <obj class="PSoundSlot" ID="7">
+            <member name="name">
+               <string name="s" value="odder" wide="true"/>
+            </member>
+            <obj class="PSlotMidiAction" name="action" ID="8"/>
+            <member name="sv">
+               <int name="ownership" value="2"/>
+               <list name="sv" type="obj">
+                  <obj class="USlotVisuals" ID="3"/>
+               </list>
+            </member>
+         </obj>
+      </list>
+   </member>
+</InstrumentMap>`)
+	project, _, warnings, err := ImportCubaseExpressionMap(data)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, Warnings{`no Dorico technique for articulation "wibble"; left out slots odd, odder`}, warnings)
+	assert.Equal(t, map[string]string{"Staccato": ""}, articulationsByName(t, project))
+}
+
+// CubaseSample is laid out the way Cubase writes expression maps: owned lists are named
+// "obj", slots refer to their articulations by ID from lists named "s".
+func TestImportCubaseExpressionMap_CubaseLayout(t *testing.T) {
+	data, err := ioutil.ReadFile("test_input/CubaseSample.expressionmap")
+	if !assert.Nil(t, err) {
+		return
+	}
+	project, summary, warnings, err := ImportCubaseExpressionMap(data)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Empty(t, warnings)
+	assert.Equal(t, "Strings Sample", summary.Name)
+	assert.Equal(t, map[string]string{
+		"Natural":  "KS24=120",
+		"Staccato": "KS25=120, CC1=64",
+		"Legato":   "CH2, PC5",
+	}, articulationsByName(t, project))
+	if assert.Len(t, project.Tints, 1) {
+		for _, tint := range project.Tints {
+			assert.Equal(t, "Accent", tint.Name)
+			assert.Equal(t, "CC20=127", tint.Midi)
+		}
+	}
+	assert.Empty(t, Validate(project))
+}
@@ -8,11 +8,22 @@ type PaletteSoundId = string
 
 type VstSoundId = string
 type VstSound struct {
-	Id       VstSoundId `firestore:"Id"`
-	Name     string     `firestore:"name"`
-	Midi     string     `firestore:"midi"`
-	Stop     string     `firestore:"stop"`
-	Dynamics string     `firestore:"dyn"`
+	Id             VstSoundId `firestore:"Id"`
+	Name           string     `firestore:"name"`
+	Midi           string     `firestore:"midi"`
+	Stop           string     `firestore:"stop"`
+	Dynamics       string     `firestore:"dyn"`
+	PitchRange     string     `firestore:"pitch"`
+	TicksBefore    int        `firestore:"ticksBefore"`
+	VelocityFactor float64    `firestore:"velocityFactor"`
+	Attack         string     `firestore:"attack"`
+	// Flags are Dorico combination flags. FlagLengthFactor is set by branches, not here.
+	Flags int `firestore:"flags"`
+	// UACC names the UACC articulation the sound selects, sent as CC32 after Midi.
+	UACC string `firestore:"uacc"`
+	// UACCKeySwitch, if set, is the key switch that selects the UACC articulation instead
+	// of CC32 (UACC-KS), such as "C-2": the UACC value becomes its velocity.
+	UACCKeySwitch string `firestore:"uaccKeySwitch"`
 }
 
 type BranchId = string
@@ -23,6 +34,7 @@ type Branch struct {
 	VstSoundId string
 	Length     float64
 	Transpose  float64
+	PitchRange string
 }
 
 type CompositeSoundId = string
@@ -56,11 +68,33 @@ type Metadata struct {
 	Plugins         string `firestore:"plugins"`
 	Version         int    `firestore:"version"`
 	Description     string `firestore:"description"`
-	MiddleC         string
+	MiddleC         OctaveConvention
 }
 
 type Assignment struct {
 	Sound string `firestore:"sound"`
+	// SwitchIDs holds the Dorico base switch ids of the assignment's combinations.
+	// Combinations without one get an id derived from the key. It is a list rather than a
+	// map by condition because Firestore map keys cannot be empty, as the condition of an
+	// unconditional combination is.
+	SwitchIDs []SwitchID `firestore:"switchIds"`
+}
+
+// SwitchID is the Dorico base switch id of the combination for a branch condition, in
+// the canonical form FormatBranch writes.
+type SwitchID struct {
+	Condition string `firestore:"condition"`
+	ID        int    `firestore:"id"`
+}
+
+// SwitchID returns the stored base switch id of the combination for condition, if any.
+func (a Assignment) SwitchID(condition string) (int, bool) {
+	for _, s := range a.SwitchIDs {
+		if s.Condition == condition {
+			return s.ID, true
+		}
+	}
+	return 0, false
 }
 
 type Tint = struct {
@@ -80,7 +114,9 @@ type Project struct {
 	Tints           map[string]*Tint
 	CompositeSounds map[CompositeSoundId]*CompositeSound
 	Assignments     map[string]Assignment
-	MiddleC         string
+	MiddleC         OctaveConvention
+	Macros          Macros
+	Controllers     Controllers
 }
 
 type AudioExample struct {
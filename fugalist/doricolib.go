@@ -2,8 +2,9 @@ package fugalist
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/mhcoffin/go-doricolib/doricolib"
-	"log"
 )
 
 /**
@@ -13,20 +14,60 @@ func CreateDoricoLib(uid string, pid string) (*doricolib.ScoreLib, error) {
 	ctx := context.Background()
 	db, err := NewClient(ctx, uid)
 	if err != nil {
-		log.Fatalf("failed to create firestore client: %s", err)
+		return nil, fmt.Errorf("failed to create firestore client: %w", err)
 	}
-	projectSummary, err := db.ReadProjectSummary(ctx, pid)
+	lib, err := GenerateDoricoLib(ctx, &db, pid)
 	if err != nil {
-		log.Fatalf("failed to read user project summary: %v", err)
+		return nil, fmt.Errorf("failed to generate doricolib for %s: %w", pid, err)
 	}
-	project, err := db.ReadProject(ctx, pid)
+	return lib, nil
+}
+
+// GenerateDoricoLib reads a project and its summary from store and creates a ScoreLib
+// containing its expression map.
+func GenerateDoricoLib(ctx context.Context, store Store, pid string) (*doricolib.ScoreLib, error) {
+	project, projectSummary, err := readProjectAndSummary(ctx, store, pid)
 	if err != nil {
-		log.Fatalf("failed: %s", err)
+		return nil, err
 	}
 	xmap, err := project.CreateExpressionMap(*projectSummary)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	lib := doricolib.CreateDoricoLib([]doricolib.ExpressionMap{*xmap})
 	return lib, nil
 }
+
+// ImportDoricoLib imports every expression map in lib as a new project in store and
+// returns the ids of the new projects and the warnings from ImportExpressionMap. A map keeps no notation of its own, so a map generated
+// from a project that is still in store takes that project's notation (see RestoreNotation);
+// any other map is imported in the default notation, with key switches as numbers and plain
+// control changes.
+func ImportDoricoLib(ctx context.Context, store Store, lib *doricolib.ScoreLib) ([]ProjectId, Warnings, error) {
+	result := make([]ProjectId, 0)
+	var warnings Warnings
+	for k := range lib.ExpressionMaps.Entities.Contents {
+		xmap := &lib.ExpressionMaps.Entities.Contents[k]
+		project, summary, mapWarnings, err := ImportExpressionMap(xmap)
+		if err != nil {
+			return result, warnings, fmt.Errorf("failed to import expression map %s: %w", xmap.Name, err)
+		}
+		warnings = append(warnings, mapWarnings...)
+		if xmap.EntityId != "" {
+			// CreateExpressionMap uses the project id as the map's entity id.
+			reference, err := store.ReadProject(ctx, xmap.EntityId)
+			switch {
+			case err == nil:
+				project.RestoreNotation(reference)
+			case !errors.Is(err, ErrNotFound):
+				return result, warnings, fmt.Errorf("failed to read project %s: %w", xmap.EntityId, err)
+			}
+		}
+		err = store.CreateProject(ctx, project, summary)
+		if err != nil {
+			return result, warnings, fmt.Errorf("failed to save expression map %s: %w", xmap.Name, err)
+		}
+		result = append(result, project.ProjectId)
+	}
+	return result, warnings, nil
+}
@@ -0,0 +1,157 @@
+package fugalist
+
+import (
+	"context"
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Articulation is an assigned combination as seen by the DAW exporters, which have no
+// notion of conditions: one entry per combination, playing its first Dorico combo.
+type Articulation struct {
+	// Name is the technique names joined with " + ", or "Natural".
+	Name string
+	// Techniques are the non-default techniques of the combination, in axis order.
+	Techniques []Technique
+	// Group is the index, among axes with more than one technique, of the axis of the
+	// first technique. It is 0 for the natural combination.
+	Group int
+	// Groups are the groups of the axes of Techniques, one for each technique.
+	Groups []int
+	Combo  *doricolib.PlayingTechniqueCombination
+}
+
+// Articulations lists the assigned combinations of the project using the combos built by
+// CreateCombos.
+func (p *Project) Articulations() ([]Articulation, error) {
+	combos, err := p.CreateCombos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create combinations: %w", err)
+	}
+
+	// Index the non-default techniques by Dorico id.
+	type location struct {
+		technique Technique
+		group     int
+	}
+	locations := make(map[string]location)
+	group := 0
+	for _, axis := range p.SortedAxes() {
+		if len(axis.Techniques) < 2 {
+			continue
+		}
+		for _, technique := range axis.Techniques[1:] {
+			locations[doricolib.GetTechniqueByName(technique.Name).Id] = location{technique, group}
+		}
+		group++
+	}
+
+	result := make([]Articulation, 0)
+	seen := make(map[string]bool)
+	for _, combo := range combos {
+		if seen[combo.TechniqueIDs] {
+			continue
+		}
+		seen[combo.TechniqueIDs] = true
+		articulation := Articulation{Name: "Natural", Techniques: []Technique{}, Groups: []int{}, Combo: combo}
+		if combo.TechniqueIDs != "pt.natural" {
+			ids := strings.Split(combo.TechniqueIDs, "+")
+			names := make([]string, len(ids))
+			for k := len(ids) - 1; k >= 0; k-- {
+				loc, ok := locations[ids[k]]
+				if !ok {
+					return nil, fmt.Errorf("technique %s is not on any axis", ids[k])
+				}
+				// CreateCombos lists techniques starting from the last axis.
+				articulation.Techniques = append(articulation.Techniques, loc.technique)
+				articulation.Groups = append(articulation.Groups, loc.group)
+				names[len(ids)-1-k] = loc.technique.Name
+				if k == len(ids)-1 {
+					articulation.Group = loc.group
+				}
+			}
+			articulation.Name = strings.Join(names, " + ")
+		}
+		result = append(result, articulation)
+	}
+	return result, nil
+}
+
+// TintActions parses the switch-on actions of a tint.
+func (p *Project) TintActions(tint *Tint) ([]doricolib.SwitchAction, error) {
+	actions, err := ParseActionList(tint.Midi, p.MiddleC, p.Macros, p.Controllers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse actions for tint %s: %w", tint.Name, err)
+	}
+	return actions, nil
+}
+
+// SortedTints returns the tints ordered by Order.
+func (p *Project) SortedTints() []*Tint {
+	result := make([]*Tint, 0, len(p.Tints))
+	for _, tint := range p.Tints {
+		result = append(result, tint)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Order != result[b].Order {
+			return result[a].Order < result[b].Order
+		}
+		return result[a].Id < result[b].Id
+	})
+	return result
+}
+
+// channelChange separates an absolute channel change from the MIDI messages of an
+// articulation. The channel is -1 if there is none. relative reports a channel change
+// relative to the instrument's channel, which DAW articulation sets can't express.
+func channelChange(actions []doricolib.SwitchAction) (channel int, messages []doricolib.SwitchAction, relative bool, err error) {
+	channel = -1
+	messages = make([]doricolib.SwitchAction, 0, len(actions))
+	for _, action := range actions {
+		switch action.Type {
+		case ActionAbsoluteChannel:
+			channel, err = strconv.Atoi(action.Param1)
+			if err != nil {
+				return -1, nil, false, fmt.Errorf("bad %s parameter: %s", action.Type, action.Param1)
+			}
+		case ActionRelativeChannel:
+			relative = true
+		default:
+			messages = append(messages, action)
+		}
+	}
+	return channel, messages, relative, nil
+}
+
+// splitRange splits a Dorico range such as "10,120" into its limits.
+func splitRange(r string) (int, int, error) {
+	parts := strings.Split(r, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("bad range: %s", r)
+	}
+	lo, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad range: %s", r)
+	}
+	hi, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad range: %s", r)
+	}
+	return lo, hi, nil
+}
+
+// readProjectAndSummary reads the project and summary the Generate functions export.
+func readProjectAndSummary(ctx context.Context, store Store, pid string) (*Project, *ProjectSummary, error) {
+	projectSummary, err := store.ReadProjectSummary(ctx, pid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read user project summary: %w", err)
+	}
+	project, err := store.ReadProject(ctx, pid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read project: %w", err)
+	}
+	return project, projectSummary, nil
+}
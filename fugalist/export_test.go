@@ -0,0 +1,46 @@
+package fugalist
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProject_Articulations(t *testing.T) {
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "KS1"}
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "KS2"}
+	project := &Project{
+		Axes: map[string]Axis{
+			axis1.Id: axis1,
+			axis2.Id: axis2,
+		},
+		VstSounds: map[VstSoundId]*VstSound{legato.Id: legato, natural.Id: natural},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis1.Techniques[0].Id, axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis1.Techniques[1].Id, axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+	}
+	articulations, err := project.Articulations()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(articulations))
+
+	assert.Equal(t, "Natural", articulations[0].Name)
+	assert.Equal(t, 0, len(articulations[0].Techniques))
+	on, err := FormatMidiEvents(articulations[0].Combo.SwitchOnActions.SwitchOnActions)
+	assert.Nil(t, err)
+	assert.Equal(t, "KS2", on)
+
+	assert.Equal(t, "Tenuto + Legato", articulations[1].Name)
+	assert.Equal(t, []Technique{axis1.Techniques[1], axis2.Techniques[1]}, articulations[1].Techniques)
+	assert.Equal(t, 0, articulations[1].Group)
+	on, err = FormatMidiEvents(articulations[1].Combo.SwitchOnActions.SwitchOnActions)
+	assert.Nil(t, err)
+	assert.Equal(t, "KS1", on)
+}
+
+func TestProject_SortedTints(t *testing.T) {
+	a := &Tint{Id: "a", Order: 2}
+	b := &Tint{Id: "b", Order: 1}
+	c := &Tint{Id: "c", Order: 2}
+	project := &Project{Tints: map[string]*Tint{"a": a, "b": b, "c": c}}
+	assert.Equal(t, []*Tint{b, a, c}, project.SortedTints())
+}
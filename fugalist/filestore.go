@@ -0,0 +1,45 @@
+package fugalist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileStore is a Store backed by a directory of JSON files laid out like test_input:
+// <pid>.project.json and <pid>.summary.json, plus user.json and shared/<pid>.<version>.json.
+type FileStore struct {
+	docStore
+}
+
+type dirBlobs string
+
+func NewFileStore(dir string, uid string) *FileStore {
+	return &FileStore{docStore{blobs: dirBlobs(dir), uid: uid}}
+}
+
+func (d dirBlobs) get(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	return data, err
+}
+
+func (d dirBlobs) put(name string, data []byte) error {
+	path := filepath.Join(string(d), filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (d dirBlobs) remove(name string) error {
+	err := os.Remove(filepath.Join(string(d), filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -1,6 +1,8 @@
 package fugalist
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -8,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -127,3 +130,410 @@ func assertEqualVstSounds(t *testing.T, expected map[VstSoundId]*VstSound, actua
 	assert.Equal(t, len(expected), len(actual))
 	assert.Equal(t, expected, actual)
 }
+
+func TestImportExpressionMap(t *testing.T) {
+	tests := []struct {
+		name string
+		// initSwitchData is whether the map has init switch data enabled.
+		initSwitchData bool
+	}{
+		{"Ref", true},
+		{"ParseTest1", false},
+		{"Messages", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			xmap := getXmap(ReadDoricolib(t, test.name))
+			project, summary, warnings, err := ImportExpressionMap(xmap)
+			if !assert.Nil(t, err) {
+				return
+			}
+			if test.initSwitchData {
+				assert.Equal(t, Warnings{"init switch data of " + xmap.Name + " is not imported"}, warnings)
+			} else {
+				assert.Empty(t, warnings)
+			}
+			assert.Equal(t, xmap.Name, summary.Name)
+			assert.Equal(t, project.ProjectId, summary.ProjectID)
+
+			regenerated, err := project.CreateExpressionMap(*summary)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, getPtMap(t, xmap), getPtMap(t, regenerated))
+		})
+	}
+}
+
+func TestImportExpressionMap_Messages(t *testing.T) {
+	project, _, _, err := ImportExpressionMap(getXmap(ReadDoricolib(t, "Messages")))
+	if !assert.Nil(t, err) {
+		return
+	}
+	midi := make([]string, 0)
+	for _, vstSound := range project.VstSounds {
+		midi = append(midi, vstSound.Midi)
+	}
+	// Bank select and a 14-bit controller stay as pairs of control changes.
+	assert.ElementsMatch(t, []string{
+		"NRPN300=1000",
+		"CC0=1, CC32=3, PC5",
+		"CC1=70, CC33=40",
+		"RPN0=256, CH2",
+	}, midi)
+}
+
+func TestAssignmentKey(t *testing.T) {
+	axes := []Axis{
+		{Id: Uniq(), Name: "Length", Techniques: []Technique{
+			{Id: Uniq(), Name: "Normal"},
+			{Id: Uniq(), Name: "Staccato"},
+			{Id: Uniq(), Name: "Tenuto"},
+		}},
+		{Id: Uniq(), Name: "Technique", Techniques: []Technique{
+			{Id: Uniq(), Name: "Normal"},
+			{Id: Uniq(), Name: "Pizzicato"},
+			{Id: Uniq(), Name: "Flautando"},
+		}},
+	}
+	tests := []struct {
+		name  string
+		combo string
+		index int
+		err   bool
+	}{
+		{"natural", "pt.natural", 0, false},
+		{"one", "pt.staccato", 3, false},
+		{"two", "pt.pizzicato+pt.tenuto", 7, false},
+		{"same axis", "pt.staccato+pt.tenuto", 0, true},
+		{"unknown", "pt.legato", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := AssignmentKey(axes, test.combo)
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, GetComboKey(axes, test.index), key)
+			}
+		})
+	}
+}
+
+func TestImportDoricoLib(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore("fred")
+	pids, warnings, err := ImportDoricoLib(ctx, store, ReadDoricolib(t, "Ref"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pids))
+	assert.Equal(t, Warnings{"init switch data of Ref is not imported"}, warnings)
+	lib, err := GenerateDoricoLib(ctx, store, pids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "Ref", getXmap(lib).Name)
+}
+
+func TestImportDoricoLib_RestoresNotation(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore("fred")
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "C0, CC14:1=9000"}
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "C#0=64, CC2=3/8", Stop: "CC0=1, CC32=3"}
+	project := &Project{
+		ProjectId: Uniq(),
+		Axes:      map[string]Axis{axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{natural.Id: natural, legato.Id: legato},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+		MiddleC: "C3",
+	}
+	err := store.CreateProject(ctx, project, &ProjectSummary{ProjectID: project.ProjectId, Name: "Notation"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	lib, err := GenerateDoricoLib(ctx, store, project.ProjectId)
+	if !assert.Nil(t, err) {
+		return
+	}
+	pids, warnings, err := ImportDoricoLib(ctx, store, lib)
+	if !assert.Nil(t, err) || !assert.Len(t, pids, 1) {
+		return
+	}
+	assert.Empty(t, warnings)
+	imported, err := store.ReadProject(ctx, pids[0])
+	if !assert.Nil(t, err) {
+		return
+	}
+	actions := make([]string, 0)
+	for _, vstSound := range imported.VstSounds {
+		actions = append(actions, vstSound.Midi+" / "+vstSound.Stop)
+	}
+	assert.ElementsMatch(t, []string{"C0, CC14:1=9000 / ", "C#0=64, CC2=3/8 / CC0=1, CC32=3"}, actions)
+}
+
+func TestImportExpressionMap_SwitchOffActions(t *testing.T) {
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "KS20", Stop: "KS30"}
+	shortLegato := &VstSound{Id: Uniq(), Name: "short legato", Midi: "KS21", Stop: "CC64=0"}
+	longLegato := &VstSound{Id: Uniq(), Name: "long legato", Midi: "KS22", Stop: "KS31=64, PC2"}
+	legato := &CompositeSound{
+		Id:   Uniq(),
+		Name: "legato",
+		Branches: map[BranchId]Branch{
+			"a": {Id: "a", Order: 1, Condition: "nl < medium", VstSoundId: shortLegato.Id},
+			"b": {Id: "b", Order: 2, Condition: "nl >= medium", VstSoundId: longLegato.Id},
+		},
+	}
+	project := &Project{
+		Axes:            map[string]Axis{axis2.Id: axis2},
+		VstSounds:       map[VstSoundId]*VstSound{natural.Id: natural, shortLegato.Id: shortLegato, longLegato.Id: longLegato},
+		CompositeSounds: map[CompositeSoundId]*CompositeSound{legato.Id: legato},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+	}
+	xmap, err := project.CreateExpressionMap(ProjectSummary{Name: "Stop"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	imported, summary, _, err := ImportExpressionMap(xmap)
+	if !assert.Nil(t, err) {
+		return
+	}
+	stops := make([]string, 0)
+	for _, vstSound := range imported.VstSounds {
+		stops = append(stops, vstSound.Stop)
+	}
+	sort.Strings(stops)
+	assert.Equal(t, []string{"CC64=0", "KS30", "KS31=64, PC2"}, stops)
+
+	regenerated, err := imported.CreateExpressionMap(*summary)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, getPtMap(t, xmap), getPtMap(t, regenerated))
+}
+
+func TestImportExpressionMap_PitchRange(t *testing.T) {
+	low := &VstSound{Id: Uniq(), Name: "low", Midi: "KS20", PitchRange: "24:59"}
+	high := &VstSound{Id: Uniq(), Name: "high", Midi: "KS20", PitchRange: "60:96"}
+	split := &CompositeSound{
+		Id:   Uniq(),
+		Name: "split",
+		Branches: map[BranchId]Branch{
+			"a": {Id: "a", Order: 1, Condition: "nl < medium", VstSoundId: low.Id},
+			"b": {Id: "b", Order: 2, Condition: "nl >= medium", VstSoundId: high.Id},
+		},
+	}
+	project := &Project{
+		Axes:            map[string]Axis{axis2.Id: axis2},
+		VstSounds:       map[VstSoundId]*VstSound{low.Id: low, high.Id: high},
+		CompositeSounds: map[CompositeSoundId]*CompositeSound{split.Id: split},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: low.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: split.Id},
+		},
+	}
+	xmap, err := project.CreateExpressionMap(ProjectSummary{Name: "Pitch"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	imported, summary, _, err := ImportExpressionMap(xmap)
+	if !assert.Nil(t, err) {
+		return
+	}
+	ranges := make([]string, 0)
+	for _, vstSound := range imported.VstSounds {
+		ranges = append(ranges, vstSound.PitchRange)
+	}
+	sort.Strings(ranges)
+	assert.Equal(t, []string{"24:59", "60:96"}, ranges)
+
+	regenerated, err := imported.CreateExpressionMap(*summary)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, getPtMap(t, xmap), getPtMap(t, regenerated))
+}
+
+func TestImportExpressionMap_ComboOptions(t *testing.T) {
+	plain := &VstSound{Id: Uniq(), Name: "plain", Midi: "KS20"}
+	early := &VstSound{Id: Uniq(), Name: "early", Midi: "KS21", TicksBefore: 20, VelocityFactor: 0.75, Attack: "CC2", Flags: 4}
+	project := &Project{
+		Axes:      map[string]Axis{axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{plain.Id: plain, early.Id: early},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: plain.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: early.Id, SwitchIDs: []SwitchID{{Condition: "", ID: 42}}},
+		},
+	}
+	xmap, err := project.CreateExpressionMap(ProjectSummary{Name: "Options"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	imported, _, _, err := ImportExpressionMap(xmap)
+	if !assert.Nil(t, err) {
+		return
+	}
+	found := false
+	for _, vstSound := range imported.VstSounds {
+		if vstSound.Midi == "KS21" {
+			found = true
+			assert.Equal(t, 20, vstSound.TicksBefore)
+			assert.Equal(t, 0.75, vstSound.VelocityFactor)
+			assert.Equal(t, "CC2", vstSound.Attack)
+			assert.Equal(t, 4, vstSound.Flags)
+		} else {
+			assert.Equal(t, 0, vstSound.TicksBefore)
+			assert.Equal(t, 0.0, vstSound.VelocityFactor)
+			assert.Equal(t, "", vstSound.Attack)
+		}
+	}
+	assert.True(t, found)
+	switchIDs := make([]int, 0)
+	for _, assignment := range imported.Assignments {
+		switchID, _ := assignment.SwitchID("")
+		switchIDs = append(switchIDs, switchID)
+	}
+	assert.Contains(t, switchIDs, 42)
+	regenerated, err := imported.CreateExpressionMap(ProjectSummary{Name: "Options"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, getPtMap(t, xmap), getPtMap(t, regenerated))
+}
+
+func TestImportDoricoLib_CompoundActions(t *testing.T) {
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "NRPN300=1000, KS20"}
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "RPN0=256", Stop: "CC14:1=9000"}
+	project := &Project{
+		Axes:      map[string]Axis{axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{natural.Id: natural, legato.Id: legato},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+	}
+	xmap, err := project.CreateExpressionMap(ProjectSummary{Name: "Compound"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	var out bytes.Buffer
+	err = doricolib.WriteXml(doricolib.CreateDoricoLib([]doricolib.ExpressionMap{*xmap}), &out)
+	if !assert.Nil(t, err) {
+		return
+	}
+	scoreLib, err := doricolib.ReadXml(out.Bytes())
+	if !assert.Nil(t, err) {
+		return
+	}
+	imported, _, _, err := ImportExpressionMap(&scoreLib.ExpressionMaps.Entities.Contents[0])
+	if !assert.Nil(t, err) {
+		return
+	}
+	actions := make([]string, 0)
+	for _, vstSound := range imported.VstSounds {
+		actions = append(actions, vstSound.Midi+" / "+vstSound.Stop)
+	}
+	sort.Strings(actions)
+	assert.Equal(t, []string{"NRPN300=1000, KS20 / ", "RPN0=256 / CC1=70, CC33=40"}, actions)
+}
+
+func TestImportExpressionMap_ChannelOnlySounds(t *testing.T) {
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "CH1"}
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "CH2", Stop: "CH-1"}
+	project := &Project{
+		Axes:      map[string]Axis{axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{natural.Id: natural, legato.Id: legato},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+	}
+	assert.Empty(t, Validate(project))
+	xmap, err := project.CreateExpressionMap(ProjectSummary{Name: "Channels"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	imported, summary, _, err := ImportExpressionMap(xmap)
+	if !assert.Nil(t, err) {
+		return
+	}
+	actions := make([]string, 0)
+	for _, vstSound := range imported.VstSounds {
+		actions = append(actions, vstSound.Midi+" / "+vstSound.Stop)
+	}
+	sort.Strings(actions)
+	assert.Equal(t, []string{"CH1 / ", "CH2 / CH-1"}, actions)
+
+	regenerated, err := imported.CreateExpressionMap(*summary)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, getPtMap(t, xmap), getPtMap(t, regenerated))
+}
+
+func TestImportExpressionMap_RestoreNotation(t *testing.T) {
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "C#1, CC32=3/8", Dynamics: "CC1 0:127", PitchRange: "D1:C6"}
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "$LEGATO", Stop: "CC64=1/2", Dynamics: "velocity 10:120"}
+	project := &Project{
+		MiddleC:   "C3",
+		Macros:    Macros{"LEGATO": "KS20=64"},
+		Axes:      map[string]Axis{axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{natural.Id: natural, legato.Id: legato},
+		Tints:     map[string]*Tint{"t": {Id: "t", Name: "Accent", Midi: "G#0"}},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+	}
+	xmap, err := project.CreateExpressionMap(ProjectSummary{Name: "Notation"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	imported, _, _, err := ImportExpressionMap(xmap)
+	if !assert.Nil(t, err) {
+		return
+	}
+	imported.RestoreNotation(project)
+	assert.Equal(t, Yamaha, imported.MiddleC)
+	assert.Equal(t, project.Macros, imported.Macros)
+	fields := make([]string, 0)
+	for _, vstSound := range imported.VstSounds {
+		fields = append(fields, strings.Join([]string{vstSound.Midi, vstSound.Stop, vstSound.Dynamics, vstSound.PitchRange}, " | "))
+	}
+	sort.Strings(fields)
+	assert.Equal(t, []string{
+		"$LEGATO | CC64=1/2 | velocity 10:120 | ",
+		"C#1, CC32=3/8 |  | CC1 0:127 | D1:C6",
+	}, fields)
+	for _, tint := range imported.Tints {
+		assert.Equal(t, "G#0", tint.Midi)
+	}
+
+	imported.Macros["LEGATO"] = "KS21"
+	assert.Equal(t, "KS20=64", project.Macros["LEGATO"])
+}
+
+func TestRestoreNotation_NoteNames(t *testing.T) {
+	reference := &Project{
+		MiddleC:   "C3",
+		VstSounds: map[VstSoundId]*VstSound{"a": {Id: "a", Midi: "C#1"}},
+	}
+	imported := &Project{
+		VstSounds: map[VstSoundId]*VstSound{"a": {Id: "a", Midi: "KS37"}, "b": {Id: "b", Midi: "KS50, CC1=3", Stop: "KS51"}},
+		Tints:     map[string]*Tint{"t": {Id: "t", Midi: "PC4"}},
+	}
+	imported.RestoreNotation(reference)
+	assert.Equal(t, Yamaha, imported.MiddleC)
+	assert.Equal(t, "C#1", imported.VstSounds["a"].Midi)
+	assert.Equal(t, "D2, CC1=3", imported.VstSounds["b"].Midi)
+	assert.Equal(t, "D#2", imported.VstSounds["b"].Stop)
+	assert.Equal(t, "PC4", imported.Tints["t"].Midi)
+
+	reference.VstSounds["a"].Midi = "KS37"
+	imported.VstSounds["b"].Midi = "KS50"
+	imported.RestoreNotation(reference)
+	assert.Equal(t, "KS50", imported.VstSounds["b"].Midi)
+}
@@ -15,6 +15,31 @@ type PlayData struct {
 	Dyn   string
 	Len   string
 	Trans string
+	Pitch string
+	// Ticks, VelFactor and Attack are zero for Dorico's defaults.
+	Ticks     int
+	VelFactor float64
+	Attack    string
+	Flags     int
+	// Switch is the base switch id of the combination. It belongs to the assignment, not
+	// the sound.
+	Switch int
+}
+
+// vstSound returns the VstSound, without id or name, that plays the data.
+func (d PlayData) vstSound() VstSound {
+	midi, uacc, _ := uaccArticulation(d.On)
+	return VstSound{
+		Midi:           midi,
+		UACC:           uacc,
+		Stop:           d.Off,
+		Dynamics:       d.Dyn,
+		PitchRange:     d.Pitch,
+		TicksBefore:    d.Ticks,
+		VelocityFactor: d.VelFactor,
+		Attack:         d.Attack,
+		Flags:          d.Flags,
+	}
 }
 
 type BrMap map[string]PlayData
@@ -25,13 +50,39 @@ func BuildPtMap(xmap *doricolib.ExpressionMap) (PtMap, error) {
 	result := make(PtMap)
 	for _, combo := range xmap.Combinations.Combos {
 		tids := CanonicalizeTechniqueString(combo.TechniqueIDs)
-		cond := FormatBranch(combo.ConditionString)
+		for _, id := range strings.Split(tids, "+") {
+			if _, ok := doricoTechniqueName(id); !ok && id != "pt.normal" {
+				return nil, fmt.Errorf("failed to import %s: unknown technique %s", tids, id)
+			}
+		}
+		cond, err := FormatBranch(combo.ConditionString)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to import condition of %s: "%s": %w`, tids, combo.ConditionString, err)
+		}
+		on, err := FormatMidiEvents(combo.SwitchOnActions.SwitchOnActions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import switch-on actions for %s: %w", tids, err)
+		}
+		off, err := ImportSwitchOffActions(combo.SwitchOffActions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import switch-off actions for %s: %w", tids, err)
+		}
+		velocityFactor, err := ImportVelocityFactor(combo.VelocityFactor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %s: %w", tids, err)
+		}
 		playData := PlayData{
-			On:    FormatMidiEvents(combo.SwitchOnActions.SwitchOnActions),
-			Off:   FormatMidiEvents(combo.SwitchOffActions.SwitchOffActions),
-			Dyn:   FormatMidiDynamic(combo.VolumeType, combo.VelocityRange),
-			Len:   FormatLengthFactor(combo.LengthFactor, combo.Flags),
-			Trans: FormatTranspose(combo.Transpose),
+			On:        on,
+			Off:       off,
+			Dyn:       FormatMidiDynamic(combo.VolumeType, combo.VelocityRange),
+			Len:       FormatLengthFactor(combo.LengthFactor, combo.Flags),
+			Trans:     FormatTranspose(combo.Transpose),
+			Pitch:     FormatPitchRange(combo.PitchRange),
+			Ticks:     combo.TicksBefore,
+			VelFactor: velocityFactor,
+			Attack:    FormatAttack(combo.AttackType),
+			Flags:     combo.Flags &^ FlagLengthFactor,
+			Switch:    combo.BaseSwitchID,
 		}
 		branchMap, exists := result[tids]
 		if exists {
@@ -44,16 +95,48 @@ func BuildPtMap(xmap *doricolib.ExpressionMap) (PtMap, error) {
 	return result, nil
 }
 
-var branchReplacer = strings.NewReplacer(
-	"kVeryShort", "veryShort",
-	"kShort", "short",
-	"kMedium", "medium",
-	"kLong", "long",
-	"kVeryLong", "veryLong",
-)
+// FormatBranch converts the condition string of a Dorico combination into a branch
+// condition in canonical Fugalist syntax, or fails if the condition can't be represented.
+func FormatBranch(br string) (string, error) {
+	conditions, err := ParseDoricoCondition(br)
+	if err != nil {
+		return "", err
+	}
+	return FormatConditions(conditions), nil
+}
 
-func FormatBranch(br string) string {
-	return branchReplacer.Replace(br)
+// FormatPitchRange converts a Dorico pitch range such as "36,95" into "36:95", or into ""
+// for the whole keyboard.
+func FormatPitchRange(r string) string {
+	if r == "" || r == "0,127" {
+		return ""
+	}
+	return strings.Replace(r, ",", ":", 1)
+}
+
+// ImportVelocityFactor converts a Dorico velocity factor into VstSound.VelocityFactor,
+// which is zero for the default of 1.
+func ImportVelocityFactor(factor string) (float64, error) {
+	if factor == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(factor, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad velocity factor: %s", factor)
+	}
+	if f == 1 {
+		return 0, nil
+	}
+	return f, nil
+}
+
+// FormatAttack converts a Dorico attack type into VstSound.Attack, which is empty for
+// velocity.
+func FormatAttack(attackType doricolib.AttackType) string {
+	if attackType.Type == "kCC" {
+		return fmt.Sprintf("CC%s", attackType.Param1)
+	}
+	return ""
 }
 
 func FormatTranspose(transpose int) string {
@@ -80,30 +163,25 @@ func FormatMidiDynamic(volumeType doricolib.VolumeType, vrange string) string {
 	if volumeType.Type == "kNoteVelocity" {
 		return fmt.Sprintf("velocity%s", rng)
 	} else if volumeType.Type == "kCC" {
-		return fmt.Sprintf("CC%s%s", volumeType.Param1, rng)
+		return fmt.Sprintf("%s%s", StandardControllers.controllerName(volumeType.Param1), rng)
 	} else {
 		return fmt.Sprintf("velocity")
 	}
 }
 
-func FormatMidiEvents(actions []doricolib.SwitchAction) string {
-	var result []string
-	for _, action := range actions {
-		switch action.Type {
-		case "kKeySwitch":
-			// TODO: convert to notes?
-			if action.Param2 != "" && action.Param2 != "127" {
-				result = append(result, fmt.Sprintf("KS%s=%s", action.Param1, action.Param2))
-			} else {
-				result = append(result, fmt.Sprintf("KS%s", action.Param1))
-			}
-		case "kProgramChange":
-			result = append(result, fmt.Sprintf("PC%s", action.Param1))
-		case "kControlChange":
-			result = append(result, fmt.Sprintf("CC%s=%s", action.Param1, action.Param2))
+// FormatMidiEvents writes switch actions in the default notation, or fails if one of them
+// has no notation.
+func FormatMidiEvents(actions []doricolib.SwitchAction) (string, error) {
+	result := make([]string, 0, len(actions))
+	for k := 0; k < len(actions); {
+		s, n := formatNext(actions[k:], defaultCodecs, 4)
+		if n == 0 {
+			return "", fmt.Errorf("no notation for %s action", actions[k].Type)
 		}
+		result = append(result, s)
+		k += n
 	}
-	return strings.Join(result, ", ")
+	return strings.Join(result, ", "), nil
 }
 
 func CanonicalizeTechniqueString(tids string) string {
@@ -143,8 +221,25 @@ func FugalistTechnique(id string) Technique {
 			Name: "Normal",
 		}
 	}
-	doricoTechnique := doricolib.GetTechniqueById(id)
-	return Technique{Id: Uniq(), Name: doricoTechnique.Name}
+	name, ok := doricoTechniqueName(id)
+	if !ok {
+		name = doricolib.GetTechniqueById(id).Name
+	}
+	return Technique{Id: Uniq(), Name: name}
+}
+
+// doricoTechniqueName returns the name doricolib.GetTechniqueByName takes for a Dorico
+// technique id, including the "pt.user." ids it gives custom techniques.
+func doricoTechniqueName(id string) (string, bool) {
+	if custom := strings.TrimPrefix(id, "pt.user."); custom != id {
+		return `Custom: "` + custom + `"`, true
+	}
+	for _, technique := range doricolib.Techniques {
+		if technique.Id == id {
+			return technique.Name, true
+		}
+	}
+	return "", false
 }
 
 // DefaultAxes returns a set of default axes with new unique IDs.
@@ -225,25 +320,34 @@ func BuildOccursWith(combos []string) func(a string, b string) bool {
 // InterferesWith returns true if technique occurs with any technique in axis.
 func InterferesWith(axis Axis, technique Technique, occursWith func(a string, b string) bool) bool {
 	for _, tech := range axis.Techniques {
-		if occursWith(tech.Id, technique.Id) {
+		if occursWith(DoricoTechniqueId(tech), DoricoTechniqueId(technique)) {
 			return true
 		}
 	}
 	return false
 }
 
+// DoricoTechniqueId returns the Dorico id (e.g., "pt.legato") of a Fugalist technique.
+// The "Normal" technique that heads the default axes maps to "pt.normal".
+func DoricoTechniqueId(technique Technique) string {
+	if technique.Name == "Normal" {
+		return "pt.normal"
+	}
+	return doricolib.GetTechniqueByName(technique.Name).Id
+}
+
 func FindAxes(combos []string) map[AxisId]Axis {
 	occursWith := BuildOccursWith(combos)
 
 	axes := DefaultAxes()
 	extras := FindExtraTechniques(combos)
-	sortOrder := 100.0
+	sortOrder := axes[len(axes)-1].SortOrder + 100
 outer:
 	for _, extra := range extras {
 		technique := FugalistTechnique(extra)
 		for k := 4; k < len(axes); k++ {
 			for _, t := range axes[k].Techniques {
-				if t.Id == technique.Id {
+				if t.Name == technique.Name {
 					continue outer
 				}
 			}
@@ -253,6 +357,7 @@ outer:
 			}
 		}
 		axes = append(axes, Axis{
+			Id:        Uniq(),
 			Name:      Uniq(),
 			SortOrder: sortOrder,
 			Techniques: []Technique{
@@ -270,28 +375,422 @@ outer:
 }
 
 func GetVstSounds(ptMap PtMap) map[VstSoundId]*VstSound {
-	vstSounds := make(map[VstSound]bool)
-
-	// Gather up the set of distinct (start, stop, dyn) tuples
-	for _, branchMap := range ptMap {
-		for _, sound := range branchMap {
-			vstSound := VstSound{
-				Midi:     sound.On,
-				Stop:     sound.Off,
-				Dynamics: sound.Dyn,
+	// Gather up the distinct (start, stop, dyn, pitch) tuples in order of combination and
+	// branch condition, so that the names below don't depend on map order
+	seen := make(map[VstSound]bool)
+	vstSounds := make([]VstSound, 0)
+	for _, combo := range getSortedCombos(ptMap) {
+		conditions := make([]string, 0, len(ptMap[combo]))
+		for cond := range ptMap[combo] {
+			conditions = append(conditions, cond)
+		}
+		sort.Strings(conditions)
+		for _, cond := range conditions {
+			key := ptMap[combo][cond].vstSound()
+			if !seen[key] {
+				seen[key] = true
+				vstSounds = append(vstSounds, key)
 			}
-			vstSounds[vstSound] = true
 		}
 	}
 
-	// Create a VstSound for each distinct tuple
+	// Create a VstSound for each distinct tuple, named after its UACC articulation if any
 	vstCount := 0
+	uaccCount := make(map[string]int)
 	result := make(map[VstSoundId]*VstSound)
-	for vstSound := range vstSounds {
-		vstCount++
+	for _, key := range vstSounds {
+		vstSound := key
 		vstSound.Id = Uniq()
-		vstSound.Name = fmt.Sprintf("vst-%d", vstCount)
+		if vstSound.UACC != "" {
+			uaccCount[vstSound.UACC]++
+			vstSound.Name = vstSound.UACC
+			if n := uaccCount[vstSound.UACC]; n > 1 {
+				vstSound.Name = fmt.Sprintf("%s %d", vstSound.UACC, n)
+			}
+		} else {
+			vstCount++
+			vstSound.Name = fmt.Sprintf("vst-%d", vstCount)
+		}
 		result[vstSound.Id] = &vstSound
 	}
 	return result
 }
+
+// ImportExpressionMap converts a Dorico expression map into a new Fugalist project and its
+// summary. Regenerating the project with CreateExpressionMap yields an equivalent map, except
+// for init switch data, which a project cannot hold: a map with init switch data enabled
+// gets a warning. doricolib does not read init actions, so that is the only sign of them.
+func ImportExpressionMap(xmap *doricolib.ExpressionMap) (*Project, *ProjectSummary, Warnings, error) {
+	ptMap, err := BuildPtMap(xmap)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to build playing technique map: %w", err)
+	}
+	project, err := BuildProject(ptMap)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tints, err := ImportTints(xmap.TechniqueAddOns)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	project.Tints = tints
+	var warnings Warnings
+	if xmap.InitSwitchData.Enabled || len(xmap.InitSwitchData.InitActions.Contents) > 0 {
+		warnings.add("init switch data of %s is not imported", xmap.Name)
+	}
+
+	version, err := strconv.Atoi(xmap.Version)
+	if err != nil {
+		version = 0
+	}
+	summary := &ProjectSummary{
+		ProjectID:   project.ProjectId,
+		Version:     version,
+		Name:        xmap.Name,
+		Description: xmap.Description,
+		Plugins:     xmap.PluginNames,
+	}
+	return project, summary, warnings, nil
+}
+
+// BuildProject creates a project from a PtMap: axes come from FindAxes, VstSounds from
+// GetVstSounds, and every combination with more than a single unconditional branch
+// becomes a composite sound.
+func BuildProject(ptMap PtMap) (*Project, error) {
+	combos := getSortedCombos(ptMap)
+	project := &Project{
+		ProjectId:       Uniq(),
+		Axes:            FindAxes(combos),
+		VstSounds:       GetVstSounds(ptMap),
+		Tints:           make(map[string]*Tint),
+		CompositeSounds: make(map[CompositeSoundId]*CompositeSound),
+		Assignments:     make(map[string]Assignment),
+	}
+	vstSoundIds := make(map[VstSound]VstSoundId)
+	for id, vstSound := range project.VstSounds {
+		key := *vstSound
+		key.Id, key.Name = "", ""
+		vstSoundIds[key] = id
+	}
+	compositeSoundIds := make(map[string]CompositeSoundId)
+
+	axes := project.SortedAxes()
+	for _, combo := range combos {
+		key, err := AssignmentKey(axes, combo)
+		if err != nil {
+			return nil, err
+		}
+		branchMap := ptMap[combo]
+		switchIDs := make([]SwitchID, 0, len(branchMap))
+		for _, cond := range sortedConditions(branchMap) {
+			switchIDs = append(switchIDs, SwitchID{Condition: cond, ID: branchMap[cond].Switch})
+		}
+		if isSimple(branchMap) {
+			sound := branchMap[""]
+			project.Assignments[key] = Assignment{Sound: vstSoundIds[sound.vstSound()], SwitchIDs: switchIDs}
+			continue
+		}
+		signature := branchSignature(branchMap)
+		id, exists := compositeSoundIds[signature]
+		if !exists {
+			compositeSound, err := buildCompositeSound(branchMap, vstSoundIds)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import %s: %w", combo, err)
+			}
+			compositeSound.Name = fmt.Sprintf("composite-%d", len(compositeSoundIds)+1)
+			compositeSound.Order = float64(100 * (len(compositeSoundIds) + 1))
+			id = compositeSound.Id
+			compositeSoundIds[signature] = id
+			project.CompositeSounds[id] = compositeSound
+		}
+		project.Assignments[key] = Assignment{Sound: id, SwitchIDs: switchIDs}
+	}
+	return project, nil
+}
+
+// AssignmentKey returns the key in Project.Assignments for a canonical combination of
+// Dorico technique ids such as "pt.legato+pt.staccato".
+func AssignmentKey(axes []Axis, combo string) (string, error) {
+	remaining := make(map[string]bool)
+	for _, pt := range strings.Split(combo, "+") {
+		if pt != "pt.natural" {
+			remaining[pt] = true
+		}
+	}
+	ids := make([]TechniqueId, len(axes))
+	for k, axis := range axes {
+		ids[k] = axis.Techniques[0].Id
+		for _, technique := range axis.Techniques[1:] {
+			pt := DoricoTechniqueId(technique)
+			if remaining[pt] {
+				if ids[k] != axis.Techniques[0].Id {
+					return "", fmt.Errorf("combination %s has two techniques from axis %s", combo, axis.Name)
+				}
+				ids[k] = technique.Id
+				delete(remaining, pt)
+			}
+		}
+	}
+	for pt := range remaining {
+		return "", fmt.Errorf("combination %s: technique %s is not on any axis", combo, pt)
+	}
+	return Xor(ids), nil
+}
+
+// ImportTints converts Dorico technique add-ons into Tints.
+func ImportTints(addOns doricolib.TechniqueAddOnList) (map[string]*Tint, error) {
+	result := make(map[string]*Tint)
+	for k, addOn := range addOns.TechniqueAddOns {
+		if strings.Contains(addOn.TechniqueIDs, "+") {
+			return nil, fmt.Errorf("add-on for more than one technique: %s", addOn.TechniqueIDs)
+		}
+		name, ok := doricoTechniqueName(addOn.TechniqueIDs)
+		if !ok {
+			return nil, fmt.Errorf("add-on for unknown technique: %s", addOn.TechniqueIDs)
+		}
+		midi, err := FormatMidiEvents(addOn.SwitchOnActions.SwitchOnActions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import switch-on actions for add-on %s: %w", addOn.TechniqueIDs, err)
+		}
+		stop, err := FormatMidiEvents(addOn.SwitchOffActions.SwitchOffActions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import switch-off actions for add-on %s: %w", addOn.TechniqueIDs, err)
+		}
+		tint := &Tint{
+			Id:    Uniq(),
+			Order: 100 * (k + 1),
+			Name:  name,
+			Midi:  midi,
+			Stop:  stop,
+		}
+		result[tint.Id] = tint
+	}
+	return result, nil
+}
+
+func getSortedCombos(ptMap PtMap) []string {
+	combos := make([]string, 0, len(ptMap))
+	for combo := range ptMap {
+		combos = append(combos, combo)
+	}
+	sort.Strings(combos)
+	return combos
+}
+
+// isSimple returns true if a combination plays a single VstSound without conditions,
+// length factor or transposition.
+func isSimple(branchMap BrMap) bool {
+	sound, ok := branchMap[""]
+	return len(branchMap) == 1 && ok && sound.Len == "" && (sound.Trans == "" || sound.Trans == "0")
+}
+
+func sortedConditions(branchMap BrMap) []string {
+	conditions := make([]string, 0, len(branchMap))
+	for cond := range branchMap {
+		conditions = append(conditions, cond)
+	}
+	sort.Strings(conditions)
+	return conditions
+}
+
+// branchSignature identifies combinations whose branches are identical, so they can share
+// a composite sound.
+func branchSignature(branchMap BrMap) string {
+	var sb strings.Builder
+	for _, cond := range sortedConditions(branchMap) {
+		sound := branchMap[cond]
+		sound.Switch = 0
+		fmt.Fprintf(&sb, "%q:%+v;", cond, sound)
+	}
+	return sb.String()
+}
+
+func buildCompositeSound(branchMap BrMap, vstSoundIds map[VstSound]VstSoundId) (*CompositeSound, error) {
+	compositeSound := &CompositeSound{
+		Id:       Uniq(),
+		Branches: make(map[BranchId]Branch),
+	}
+	for k, cond := range sortedConditions(branchMap) {
+		sound := branchMap[cond]
+		length := 0.0
+		if sound.Len != "" {
+			l, err := strconv.Atoi(sound.Len)
+			if err != nil {
+				return nil, fmt.Errorf("bad length factor: %s", sound.Len)
+			}
+			length = float64(l)
+		}
+		transpose := 0.0
+		if sound.Trans != "" {
+			t, err := strconv.Atoi(sound.Trans)
+			if err != nil {
+				return nil, fmt.Errorf("bad transpose: %s", sound.Trans)
+			}
+			transpose = float64(t)
+		}
+		branch := Branch{
+			Id:         Uniq(),
+			Order:      float64(100 * (k + 1)),
+			Condition:  cond,
+			VstSoundId: vstSoundIds[sound.vstSound()],
+			Length:     length,
+			Transpose:  transpose,
+		}
+		compositeSound.Branches[branch.Id] = branch
+	}
+	return compositeSound, nil
+}
+
+// RestoreNotation rewrites the action lists, dynamics and pitch ranges of an imported
+// project in the notation of a reference project, typically the one the expression map was
+// generated from. A field that means the same as one in the reference is written the way
+// the reference writes it, so note names, fractions, macros and controller aliases survive
+// generate and import. If the reference writes key switches as note names, action lists it
+// has no way of writing get note names too. The project takes copies of the reference's
+// middle C, macros and controller aliases so that they keep their meaning. ImportDoricoLib
+// calls it when the reference is still in the store; without one, the notation is lost.
+func (p *Project) RestoreNotation(reference *Project) {
+	actions := func(middleC OctaveConvention, macros Macros, controllers Controllers) func(string) (string, error) {
+		return func(s string) (string, error) {
+			parsed, err := ParseActionList(s, middleC, macros, controllers)
+			if err != nil {
+				return "", err
+			}
+			return FormatActions(parsed)
+		}
+	}
+	pitchRange := func(middleC OctaveConvention) func(string) (string, error) {
+		return func(s string) (string, error) {
+			return ParsePitchRange(s, middleC)
+		}
+	}
+	dynamics := func(controllers Controllers) func(string) (string, error) {
+		return func(s string) (string, error) {
+			volType, volRange, err := ParseVolumeSpec(s, controllers)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s %s %s", volType.Type, volType.Param1, volRange), nil
+		}
+	}
+
+	writesNotes := func(s string) bool {
+		octave, err := reference.MiddleC.Octave()
+		if err != nil {
+			return false
+		}
+		_, notation, err := parseActionNotation(s, octave, reference.Macros, reference.Controllers, nil)
+		if err != nil {
+			return false
+		}
+		for _, codec := range notation {
+			if _, ok := codec.(noteCodec); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	refActions := newNotation(actions(reference.MiddleC, reference.Macros, reference.Controllers))
+	refPitch := newNotation(pitchRange(reference.MiddleC))
+	refDynamics := newNotation(dynamics(reference.Controllers))
+	notes := false
+	for _, id := range sortedKeys(reference.VstSounds) {
+		vstSound := reference.VstSounds[id]
+		refActions.add(vstSound.Midi)
+		refActions.add(vstSound.Stop)
+		notes = notes || writesNotes(vstSound.Midi) || writesNotes(vstSound.Stop)
+		refPitch.add(vstSound.PitchRange)
+		refDynamics.add(vstSound.Dynamics)
+	}
+	for _, id := range sortedKeys(reference.CompositeSounds) {
+		for _, branch := range reference.CompositeSounds[id].SortedBranches() {
+			refPitch.add(branch.PitchRange)
+		}
+	}
+	for _, tint := range reference.SortedTints() {
+		refActions.add(tint.Midi)
+		refActions.add(tint.Stop)
+		notes = notes || writesNotes(tint.Midi) || writesNotes(tint.Stop)
+	}
+
+	ownActions, ownPitch := actions(p.MiddleC, p.Macros, p.Controllers), pitchRange(p.MiddleC)
+	ownDynamics := dynamics(p.Controllers)
+	restoreActions := func(s *string) {
+		if refActions.restore(s, ownActions) || !notes {
+			return
+		}
+		parsed, err := ParseActionList(*s, p.MiddleC, p.Macros, p.Controllers)
+		if err != nil {
+			return
+		}
+		if formatted, err := FormatActionsAsNotes(parsed, reference.MiddleC); err == nil {
+			*s = formatted
+		}
+	}
+	for _, vstSound := range p.VstSounds {
+		// The importer takes a trailing CC32 for a UACC articulation; the reference may
+		// have written it in Midi.
+		restored := false
+		if value, err := UACCValue(vstSound.UACC); err == nil && vstSound.UACC != "" {
+			midi := strings.TrimPrefix(fmt.Sprintf("%s, CC32=%d", vstSound.Midi, value), ", ")
+			if restored = refActions.restore(&midi, ownActions); restored {
+				vstSound.Midi, vstSound.UACC = midi, ""
+			}
+		}
+		if !restored {
+			restoreActions(&vstSound.Midi)
+		}
+		restoreActions(&vstSound.Stop)
+		refPitch.restore(&vstSound.PitchRange, ownPitch)
+		refDynamics.restore(&vstSound.Dynamics, ownDynamics)
+	}
+	for _, compositeSound := range p.CompositeSounds {
+		for id, branch := range compositeSound.Branches {
+			refPitch.restore(&branch.PitchRange, ownPitch)
+			compositeSound.Branches[id] = branch
+		}
+	}
+	for _, tint := range p.Tints {
+		restoreActions(&tint.Midi)
+		restoreActions(&tint.Stop)
+	}
+	p.MiddleC = reference.MiddleC.Named()
+	p.Macros = reference.Macros.copy()
+	p.Controllers = reference.Controllers.copy()
+}
+
+// notation maps the canonical form of a field to the first way a reference project writes
+// it.
+type notation struct {
+	canonical func(string) (string, error)
+	written   map[string]string
+}
+
+func newNotation(canonical func(string) (string, error)) *notation {
+	return &notation{canonical: canonical, written: make(map[string]string)}
+}
+
+func (n *notation) add(s string) {
+	key, err := n.canonical(s)
+	if err != nil || s == "" {
+		return
+	}
+	if _, ok := n.written[key]; !ok {
+		n.written[key] = s
+	}
+}
+
+// restore replaces *s, read with canonical, by the reference's way of writing it, if any,
+// and reports whether it did.
+func (n *notation) restore(s *string, canonical func(string) (string, error)) bool {
+	key, err := canonical(*s)
+	if err != nil {
+		return false
+	}
+	written, ok := n.written[key]
+	if ok {
+		*s = written
+	}
+	return ok
+}
@@ -18,7 +18,7 @@ func TestImportVelocity(t *testing.T) {
 			for _, combo := range scoreLib.ExpressionMaps.Entities.Contents[0].Combinations.Combos {
 				dyn, err := ImportDynamics(combo.VolumeType, combo.VelocityRange)
 				assert.Nil(t, err)
-				volType, rng, err := ParseVolumeSpec(dyn)
+				volType, rng, err := ParseVolumeSpec(dyn, nil)
 				assert.Nil(t, err)
 				assert.Equal(t, &combo.VolumeType, volType)
 				assert.Equal(t, combo.VelocityRange, rng)
@@ -41,10 +41,41 @@ func TestImportSwitchOnActions(t *testing.T) {
 				switchOnActionList := combo.SwitchOnActions
 				midi, err := ImportSwitchOnActions(switchOnActionList)
 				assert.Nil(t, err)
-				switchOnActions, err := ParseSwitchOnActionList(midi, "4")
+				switchOnActions, err := ParseSwitchOnActionList(midi, Scientific, nil, nil)
 				assert.Nil(t, err)
 				assert.Equal(t, &switchOnActionList, switchOnActions)
 			}
 		})
 	}
 }
+
+func TestImportSwitchOffActions(t *testing.T) {
+	tests := []struct {
+		name string
+		stop string
+	}{
+		{"empty", ""},
+		{"KS", "KS24"},
+		{"KS with velocity", "KS24=64"},
+		{"mixed", "CC1=0, KS25, PC2"},
+		{"NRPN", "NRPN300=1000"},
+		{"RPN", "RPN0=256, KS25"},
+		{"controller pair", "CC1=70, CC33=40"},
+		{"bank select", "CC0=1, CC32=3, PC5"},
+		{"pitch bend", "PB=-4096"},
+		{"channel pressure", "AT=90"},
+		{"unpaired CC", "CC1=2, CC34=3"},
+		{"channel", "CH3"},
+		{"relative channel", "CH+2, KS25"},
+		{"channel down", "CH-1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			switchOffActionList, err := ParseSwitchOffActionList(test.stop, "C4", nil, nil)
+			assert.Nil(t, err)
+			stop, err := ImportSwitchOffActions(*switchOffActionList)
+			assert.Nil(t, err)
+			assert.Equal(t, test.stop, stop)
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package fugalist
 
 import (
-	"fmt"
 	"regexp"
 	"unicode"
 )
@@ -50,7 +49,27 @@ func (com ComparisonOperator) Opposite() ComparisonOperator {
 	case GT:
 		return LT
 	case GE:
+		return LE
+	default:
+		panic("no such comparison operator")
+	}
+}
+
+// Negation returns the operator that holds exactly when com does not.
+func (com ComparisonOperator) Negation() ComparisonOperator {
+	switch com {
+	case LT:
+		return GE
+	case LE:
 		return GT
+	case EQ:
+		return NE
+	case NE:
+		return EQ
+	case GT:
+		return LE
+	case GE:
+		return LT
 	default:
 		panic("no such comparison operator")
 	}
@@ -115,9 +134,13 @@ type Conjunction int
 const (
 	NoConjunction Conjunction = iota
 	And
+	Or
 )
 
 func (conj Conjunction) String() string {
+	if conj == Or {
+		return "OR"
+	}
 	return "AND"
 }
 
@@ -144,8 +167,8 @@ func (in Input) SkipWhitespace() Input {
 func (in Input) MustBe(regexp *regexp.Regexp) (Input, string, error) {
 	inp := in.SkipWhitespace()
 	pos := regexp.FindStringIndex(string(inp))
-	if pos == nil {
-		return inp, "", fmt.Errorf("expected to match %s at %s", regexp.String(), inp.String())
+	if pos == nil || pos[0] != 0 {
+		return inp, "", inp.expected(regexp.String())
 	}
 	return inp[pos[1]:], string(inp[pos[0]:pos[1]]), nil
 }
@@ -155,17 +178,17 @@ func (in Input) MustBeIdentifier() (Input, string, error) {
 	r.Longest()
 	rest, id, err := in.MustBe(r)
 	if err != nil {
-		return rest, id, fmt.Errorf(`identifier expected: "%s"`, in)
+		return rest, id, in.expected("identifier")
 	}
 	return rest, id, err
 }
 
-var noteLengthRegexp = regexp.MustCompile(`(?i)(note\s*length)|(nl)`)
+var noteLengthRegexp = regexp.MustCompile(`^(?i)(note\s*length|nl)`)
 
 func (in Input) MustBeVariable() (Input, Variable, error) {
 	rest, _, err := in.MustBe(noteLengthRegexp)
 	if err != nil {
-		return in, NoVariable, fmt.Errorf("variable name expected: %w", err)
+		return in, NoVariable, in.expected("NoteLength")
 	}
 	return rest, "NoteLength", nil
 }
@@ -197,7 +220,7 @@ func (in Input) MustBeConstant() (Input, Constant, error) {
 	if err == nil {
 		return rest, "veryLong", nil
 	}
-	return rest, "?", fmt.Errorf("expected constant")
+	return rest, "?", in.expected(string(VeryShort), string(Short), string(Medium), string(Long), string(VeryLong))
 }
 
 func (in Input) MustBeComparisonOperator() (Input, ComparisonOperator, error) {
@@ -205,18 +228,20 @@ func (in Input) MustBeComparisonOperator() (Input, ComparisonOperator, error) {
 	r.Longest()
 	rest, op, err := in.MustBe(r)
 	if err != nil {
-		return in, NoComparison, err
+		return in, NoComparison, in.expected("<", "<=", ">", ">=", "==", "!=")
 	}
 	return rest, ComparisonOperatorMap[op], nil
 }
 
-func (in Input) MustBeConjunction() (Input, Conjunction, error) {
-	r := regexp.MustCompile(`(?i)^(and)`)
-	r.Longest()
+var conjunctionRegexp = regexp.MustCompile(`(?i)^(and|or)\b`)
 
-	rest, _, err := in.MustBe(r)
+func (in Input) MustBeConjunction() (Input, Conjunction, error) {
+	rest, conj, err := in.MustBe(conjunctionRegexp)
 	if err != nil {
-		return in, NoConjunction, err
+		return in, NoConjunction, in.expected("AND", "OR")
+	}
+	if conj[0] == 'o' || conj[0] == 'O' {
+		return rest, Or, nil
 	}
 	return rest, And, nil
 }
@@ -143,6 +143,24 @@ func TestInput_MustBeComparisonOperator(t *testing.T) {
 	}
 }
 
+func TestComparisonOperator_Opposite(t *testing.T) {
+	tests := []struct {
+		op       ComparisonOperator
+		expected ComparisonOperator
+	}{
+		{LT, GT},
+		{LE, GE},
+		{EQ, EQ},
+		{NE, NE},
+		{GT, LT},
+		{GE, LE},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.op.Opposite())
+		assert.Equal(t, test.op, test.op.Opposite().Opposite())
+	}
+}
+
 func TestInput_MustBeVariable(t *testing.T) {
 	tests := []struct {
 		name string
@@ -209,6 +227,8 @@ func TestInput_MustBeConjunction(t *testing.T) {
 		ok       bool
 	}{
 		{" and NL < very short", And, true},
+		{" OR NL < very short", Or, true},
+		{" order", NoConjunction, false},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
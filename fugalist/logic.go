@@ -0,0 +1,182 @@
+package fugalist
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"strconv"
+)
+
+// Logic numbers articulations 1 to 254.
+const logicArticulations = 254
+
+// LogicOutput is one output event of a Logic articulation.
+type LogicOutput struct {
+	Status   string
+	MB1      int
+	ValueLow int
+	// Channel is the MIDI channel, 0 to 15, or -1 to send on the track's channel.
+	Channel int
+}
+
+// LogicOutputEvent converts a Dorico switch action into a Logic output event.
+func LogicOutputEvent(action doricolib.SwitchAction) (LogicOutput, error) {
+	output := LogicOutput{Channel: -1}
+	switch action.Type {
+	case "kKeySwitch":
+		output.Status = "Note On"
+	case "kControlChange":
+		output.Status = "Controller"
+	case "kProgramChange":
+		output.Status = "Program"
+	case ActionChannelPressure:
+		output.Status = "Aftertouch"
+	case ActionPitchBend:
+		bend, err := strconv.Atoi(action.Param1)
+		if err != nil {
+			return LogicOutput{}, fmt.Errorf("bad %s parameter: %s", action.Type, action.Param1)
+		}
+		return LogicOutput{Status: "Pitch Bend", MB1: bend & 127, ValueLow: bend >> 7, Channel: -1}, nil
+	default:
+		return LogicOutput{}, fmt.Errorf("no Logic equivalent for %s", action.Type)
+	}
+	var err error
+	output.MB1, err = strconv.Atoi(action.Param1)
+	if err != nil {
+		return LogicOutput{}, fmt.Errorf("bad %s parameter: %s", action.Type, action.Param1)
+	}
+	if action.Type != "kProgramChange" && action.Param2 != "" {
+		output.ValueLow, err = strconv.Atoi(action.Param2)
+		if err != nil {
+			return LogicOutput{}, fmt.Errorf("bad %s parameter: %s", action.Type, action.Param2)
+		}
+	}
+	return output, nil
+}
+
+// plistWriter writes the property list elements of an articulation set.
+type plistWriter struct {
+	out    bytes.Buffer
+	indent int
+}
+
+func (w *plistWriter) line(format string, args ...interface{}) {
+	for k := 0; k < w.indent; k++ {
+		w.out.WriteString("\t")
+	}
+	fmt.Fprintf(&w.out, format, args...)
+	w.out.WriteString("\n")
+}
+
+func (w *plistWriter) open(element string) {
+	w.line("<%s>", element)
+	w.indent++
+}
+
+func (w *plistWriter) close(element string) {
+	w.indent--
+	w.line("</%s>", element)
+}
+
+func (w *plistWriter) key(key string) {
+	w.line("<key>%s</key>", key)
+}
+
+func (w *plistWriter) integer(key string, value int) {
+	w.key(key)
+	w.line("<integer>%d</integer>", value)
+}
+
+func (w *plistWriter) string(key string, value string) {
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(value))
+	w.key(key)
+	w.line("<string>%s</string>", escaped.String())
+}
+
+// CreateLogicArticulationSet creates a Logic Pro articulation set (.plist) for the project.
+// Each assigned combination becomes an articulation whose output events are its switch-on
+// actions, sent on the channel of its channel change, if any. Composite sounds play their
+// first branch; tints have no Logic equivalent. Articulations that change channel relative
+// to the track are left out with a warning.
+func (p *Project) CreateLogicArticulationSet(summary ProjectSummary) ([]byte, Warnings, error) {
+	articulations, err := p.Articulations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(articulations) > logicArticulations {
+		return nil, nil, fmt.Errorf("%d combinations: Logic supports at most %d", len(articulations), logicArticulations)
+	}
+	var warnings Warnings
+
+	w := &plistWriter{}
+	w.out.WriteString(xml.Header)
+	w.line(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`)
+	w.line(`<plist version="1.0">`)
+	w.open("dict")
+	w.key("Articulations")
+	w.open("array")
+	id := 0
+	for _, articulation := range articulations {
+		channel, actions, relative, err := channelChange(articulation.Combo.SwitchOnActions.SwitchOnActions)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create articulation %s: %w", articulation.Name, err)
+		}
+		if relative {
+			warnings.add("left out articulation %s: Logic has no relative channel change", articulation.Name)
+			continue
+		}
+		if channel >= 0 && len(actions) == 0 {
+			warnings.add("articulation %s sends no events, so Logic can't change its channel", articulation.Name)
+		}
+		outputs := make([]LogicOutput, 0)
+		for _, action := range actions {
+			output, err := LogicOutputEvent(action)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create articulation %s: %w", articulation.Name, err)
+			}
+			output.Channel = channel
+			outputs = append(outputs, output)
+		}
+		id++
+		w.open("dict")
+		w.integer("ArticulationID", id)
+		w.integer("ID", 1000+id)
+		w.string("Name", articulation.Name)
+		if len(outputs) > 0 {
+			w.key("Output")
+			w.open("array")
+			for _, output := range outputs {
+				w.open("dict")
+				if output.Channel >= 0 {
+					w.integer("Channel", output.Channel)
+				}
+				w.integer("MB1", output.MB1)
+				w.string("Status", output.Status)
+				if output.Status != "Program" {
+					w.integer("ValueLow", output.ValueLow)
+				}
+				w.close("dict")
+			}
+			w.close("array")
+		}
+		w.close("dict")
+	}
+	w.close("array")
+	w.string("Name", summary.Name)
+	w.close("dict")
+	w.line("</plist>")
+	return w.out.Bytes(), warnings, nil
+}
+
+// GenerateLogicArticulationSet reads a project and its summary from store and creates a
+// Logic Pro articulation set for it.
+func GenerateLogicArticulationSet(ctx context.Context, store Store, pid string) ([]byte, Warnings, error) {
+	project, projectSummary, err := readProjectAndSummary(ctx, store, pid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return project.CreateLogicArticulationSet(*projectSummary)
+}
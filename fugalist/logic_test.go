@@ -0,0 +1,104 @@
+package fugalist
+
+import (
+	"context"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLogicOutputEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   doricolib.SwitchAction
+		expected LogicOutput
+		err      bool
+	}{
+		{"KS", doricolib.SwitchAction{Type: "kKeySwitch", Param1: "24", Param2: "100"}, LogicOutput{"Note On", 24, 100, -1}, false},
+		{"CC", doricolib.SwitchAction{Type: "kControlChange", Param1: "1", Param2: "64"}, LogicOutput{"Controller", 1, 64, -1}, false},
+		{"PC", doricolib.SwitchAction{Type: "kProgramChange", Param1: "7", Param2: "0"}, LogicOutput{"Program", 7, 0, -1}, false},
+		{"pitch bend", doricolib.SwitchAction{Type: ActionPitchBend, Param1: "9000"}, LogicOutput{"Pitch Bend", 40, 70, -1}, false},
+		{"channel pressure", doricolib.SwitchAction{Type: ActionChannelPressure, Param1: "90"}, LogicOutput{"Aftertouch", 90, 0, -1}, false},
+		{"channel", doricolib.SwitchAction{Type: ActionAbsoluteChannel, Param1: "2"}, LogicOutput{}, true},
+		{"bad param", doricolib.SwitchAction{Type: "kKeySwitch", Param1: "x"}, LogicOutput{}, true},
+		{"unknown", doricolib.SwitchAction{Type: "kBogus"}, LogicOutput{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := LogicOutputEvent(test.action)
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expected, output)
+			}
+		})
+	}
+}
+
+func TestCreateLogicArticulationSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		middleC OctaveConvention
+		note    int
+	}{
+		{"C3", "C3", 36},
+		{"C4", "C4", 24},
+		{"C5", "C5", 12},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "C1"}
+			natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "PC3, CC1=64"}
+			project := &Project{
+				Axes:      map[string]Axis{axis2.Id: axis2},
+				VstSounds: map[VstSoundId]*VstSound{legato.Id: legato, natural.Id: natural},
+				Assignments: map[string]Assignment{
+					Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+					Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+				},
+				MiddleC: test.middleC,
+			}
+			plist, warnings, err := project.CreateLogicArticulationSet(ProjectSummary{Name: "Strings & Brass"})
+			assert.Nil(t, err)
+			assert.Empty(t, warnings)
+			s := string(plist)
+			assert.Contains(t, s, "<string>Strings &amp; Brass</string>")
+			assert.Contains(t, s, "<string>Natural</string>")
+			assert.Contains(t, s, "<string>Program</string>")
+			assert.Contains(t, s, "<string>Controller</string>")
+			assert.Contains(t, s, "<string>Legato</string>")
+			assert.Contains(t, s, "<key>MB1</key>\n\t\t\t\t\t<integer>"+strconv.Itoa(test.note)+"</integer>\n\t\t\t\t\t<key>Status</key>\n\t\t\t\t\t<string>Note On</string>")
+			assert.Equal(t, 2, strings.Count(s, "<key>ArticulationID</key>"))
+		})
+	}
+}
+
+func TestCreateLogicArticulationSet_Channels(t *testing.T) {
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "ch3, KS1=100"}
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "ch+1, PC3"}
+	project := &Project{
+		Axes:      map[string]Axis{axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{legato.Id: legato, natural.Id: natural},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+		MiddleC: "C4",
+	}
+	plist, warnings, err := project.CreateLogicArticulationSet(ProjectSummary{Name: "Strings"})
+	assert.Nil(t, err)
+	assert.Equal(t, Warnings{"left out articulation Natural: Logic has no relative channel change"}, warnings)
+	s := string(plist)
+	assert.Equal(t, 1, strings.Count(s, "<key>ArticulationID</key>"))
+	assert.NotContains(t, s, "<string>Natural</string>")
+	assert.Contains(t, s, "<key>Channel</key>\n\t\t\t\t\t<integer>2</integer>\n\t\t\t\t\t<key>MB1</key>\n\t\t\t\t\t<integer>1</integer>")
+}
+
+func TestGenerateLogicArticulationSet(t *testing.T) {
+	plist, _, err := GenerateLogicArticulationSet(context.Background(), NewFileStore("test_input", "fred"), "ParseTest1")
+	assert.Nil(t, err)
+	assert.Contains(t, string(plist), "<string>ParseTest1</string>")
+}
@@ -0,0 +1,69 @@
+package fugalist
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Macros maps macro names to the action lists they stand for. An action list refers to a
+// macro by name wherever an action may appear: "$LEGATO, CC1=64".
+type Macros map[string]string
+
+const macroName = `[A-Za-z_]\w*`
+
+// MacroPat matches a macro reference; MacroNamePat matches the name alone.
+var MacroPat = regexp.MustCompile(`^(\s*)\$(` + macroName + `)\s*$`)
+var MacroNamePat = regexp.MustCompile(`^` + macroName + `$`)
+
+// expand parses the definition of a macro. Expanding lists the macros already being
+// expanded, outermost first, so that a macro that refers to itself is an error rather than
+// a stack overflow. An error in the definition says what is wrong but not where: the
+// caller locates it at the reference.
+func (m Macros) expand(name string, middleCOctave int, controllers Controllers, expanding []string) ([]doricolib.SwitchAction, error) {
+	for k, outer := range expanding {
+		if outer == name {
+			cycle := append(append([]string{}, expanding[k:]...), name)
+			return nil, fmt.Errorf("macro cycle: $%s", strings.Join(cycle, " -> $"))
+		}
+	}
+	definition, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined macro: $%s", name)
+	}
+	expanding = append(append([]string{}, expanding...), name)
+	actions, _, err := parseActionNotation(definition, middleCOctave, m, controllers, expanding)
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		return nil, fmt.Errorf("failed to expand macro $%s: %s", name, perr.describe())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand macro $%s: %w", name, err)
+	}
+	return actions, nil
+}
+
+// copy returns a copy of the macros that can be changed independently, or nil for nil.
+func (m Macros) copy() Macros {
+	if m == nil {
+		return nil
+	}
+	result := make(Macros, len(m))
+	for name, definition := range m {
+		result[name] = definition
+	}
+	return result
+}
+
+// SortedNames returns the names of the macros in order.
+func (m Macros) SortedNames() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,144 @@
+package fugalist
+
+import (
+	"errors"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseActionList_Macros(t *testing.T) {
+	macros := Macros{
+		"LEGATO": "KS24, CC32=10",
+		"SOFT":   "CC1=20",
+		"BOTH":   "$LEGATO, $SOFT",
+		"EMPTY":  "",
+	}
+	tests := []struct {
+		name     string
+		input    string
+		expected []doricolib.SwitchAction
+	}{
+		{"macro", "$LEGATO", []doricolib.SwitchAction{
+			{Type: "kKeySwitch", Param1: "24", Param2: "127"},
+			{Type: "kControlChange", Param1: "32", Param2: "10"},
+		}},
+		{"macro and action", " $SOFT , CC1=64", []doricolib.SwitchAction{
+			{Type: "kControlChange", Param1: "1", Param2: "20"},
+			{Type: "kControlChange", Param1: "1", Param2: "64"},
+		}},
+		{"nested", "PC2, $BOTH", []doricolib.SwitchAction{
+			{Type: "kProgramChange", Param1: "2", Param2: "0"},
+			{Type: "kKeySwitch", Param1: "24", Param2: "127"},
+			{Type: "kControlChange", Param1: "32", Param2: "10"},
+			{Type: "kControlChange", Param1: "1", Param2: "20"},
+		}},
+		{"used twice", "$SOFT, $SOFT", []doricolib.SwitchAction{
+			{Type: "kControlChange", Param1: "1", Param2: "20"},
+			{Type: "kControlChange", Param1: "1", Param2: "20"},
+		}},
+		{"empty", "$EMPTY", []doricolib.SwitchAction{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, err := ParseActionList(test.input, "C3", macros, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actions)
+		})
+	}
+}
+
+func TestParseActionList_MacroErrors(t *testing.T) {
+	macros := Macros{
+		"A":   "$B",
+		"B":   "CC1=1, $A",
+		"C":   "$C",
+		"BAD": "KS3, CC1=",
+		"USE": "$BAD",
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"$NONE", "at offset 0: undefined macro: $NONE"},
+		{"$A", "at offset 0: failed to expand macro $A: failed to expand macro $B: macro cycle: $A -> $B -> $A"},
+		{"$C", "at offset 0: failed to expand macro $C: macro cycle: $C -> $C"},
+		{"CC7=100, $USE", "at offset 9: failed to expand macro $USE: failed to expand macro $BAD: expected value, found end of input"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := ParseActionList(test.input, "C3", macros, nil)
+			if !assert.NotNil(t, err) {
+				return
+			}
+			assert.Equal(t, test.expected, err.Error())
+		})
+	}
+
+	// An error in a definition is located at the reference.
+	_, err := ParseActionList("CC7=100,  $BAD ", "C3", macros, nil)
+	var perr *ParseError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, 10, perr.Offset)
+	assert.Equal(t, 4, perr.Length)
+	assert.Equal(t, "$BAD", perr.Token)
+
+	_, err = ParseActionList("$A", "C3", nil, nil)
+	assert.NotNil(t, err)
+
+	// A macro name does not start with a digit.
+	_, err = ParseActionList("$2BAD", "C3", Macros{"2BAD": "CC1=1"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestValidate_MacroDefinition(t *testing.T) {
+	p := &Project{Macros: Macros{"BAD": "KS3, CC1=", "2BAD": "CC1=1"}}
+	ds := Validate(p)
+	if !assert.Len(t, ds, 2) {
+		return
+	}
+	assert.Equal(t, Diagnostic{Entity: EntityMacro, Id: "2BAD", Field: "Name", Message: `bad macro name: "2BAD"`}, ds[0])
+	assert.Equal(t, Diagnostic{Entity: EntityMacro, Id: "BAD", Field: "Definition", Message: "at offset 9: expected value, found end of input"}, ds[1])
+}
+
+func TestCreateComboForVstSound_Macros(t *testing.T) {
+	vstSound := &VstSound{Id: "v", Name: "v", Midi: "$LEGATO, CC1=64", Stop: "$RESET"}
+	macros := Macros{"LEGATO": "C0", "RESET": "CC64=0"}
+	combo, err := CreateComboForVstSound("pt.natural", vstSound, "C3", macros, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []doricolib.SwitchAction{
+		{Type: "kKeySwitch", Param1: "24", Param2: "127"},
+		{Type: "kControlChange", Param1: "1", Param2: "64"},
+	}, combo.SwitchOnActions.SwitchOnActions)
+	assert.Equal(t, []doricolib.SwitchAction{
+		{Type: "kControlChange", Param1: "64", Param2: "0"},
+	}, combo.SwitchOffActions.SwitchOffActions)
+}
+
+func TestValidate_Macros(t *testing.T) {
+	project := &Project{
+		ProjectId: "p",
+		Macros: Macros{
+			"GOOD":   "KS20",
+			"LOUD":   "CC7=300",
+			"LOOP":   "$LOOP",
+			"2BAD":   "KS1",
+			"CALLER": "$GOOD",
+		},
+		VstSounds: map[VstSoundId]*VstSound{
+			"v": {Id: "v", Name: "v", Midi: "$GOOD, $MISSING"},
+		},
+	}
+	var addresses []string
+	for _, d := range Validate(project) {
+		addresses = append(addresses, d.Entity+" "+d.Id+" "+d.Field)
+	}
+	assert.Equal(t, []string{
+		"macro 2BAD Name",
+		"macro LOOP Definition",
+		"macro LOUD Definition",
+		"vstSound v Midi",
+	}, addresses)
+}
@@ -0,0 +1,35 @@
+package fugalist
+
+import (
+	"fmt"
+)
+
+// MemoryStore is a Store that keeps one user's documents in memory. Documents are
+// held in encoded form, so callers never share state with the store.
+type MemoryStore struct {
+	docStore
+}
+
+type memBlobs map[string][]byte
+
+func NewMemoryStore(uid string) *MemoryStore {
+	return &MemoryStore{docStore{blobs: make(memBlobs), uid: uid}}
+}
+
+func (m memBlobs) get(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	return data, nil
+}
+
+func (m memBlobs) put(name string, data []byte) error {
+	m[name] = data
+	return nil
+}
+
+func (m memBlobs) remove(name string) error {
+	delete(m, name)
+	return nil
+}
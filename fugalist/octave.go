@@ -0,0 +1,68 @@
+package fugalist
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OctaveConvention is the name a project gives middle C (MIDI note 60). It fixes the octave
+// numbers of note names: under Yamaha, note 60 is C3; under Scientific and Roland it is C4.
+// Older projects store the name of middle C itself ("C3", "C4" or "C5"); those are still
+// accepted.
+type OctaveConvention string
+
+const (
+	// Yamaha calls middle C "C3", as Cubase and Dorico do.
+	Yamaha OctaveConvention = "Yamaha"
+	// Scientific pitch notation calls middle C "C4". It is the default.
+	Scientific OctaveConvention = "Scientific"
+	// Roland also calls middle C "C4".
+	Roland OctaveConvention = "Roland"
+	// MiddleC5 calls middle C "C5", as some samplers do. It has no other name.
+	MiddleC5 OctaveConvention = "C5"
+)
+
+// OctaveConventions are the conventions a project may choose.
+var OctaveConventions = []OctaveConvention{Yamaha, Scientific, Roland, MiddleC5}
+
+// Octave returns the octave number of middle C. The empty convention is Scientific; case
+// is ignored.
+func (c OctaveConvention) Octave() (int, error) {
+	switch strings.ToUpper(string(c)) {
+	case "YAMAHA", "C3":
+		return 3, nil
+	case "", "SCIENTIFIC", "ROLAND", "C4":
+		return 4, nil
+	case "C5":
+		return 5, nil
+	default:
+		return 0, fmt.Errorf("unknown middle C: %q", string(c))
+	}
+}
+
+// Named returns the convention as it is stored: one of OctaveConventions, with the old
+// "C3" and "C4" mapped to Yamaha and Scientific. The empty and unknown conventions are
+// returned unchanged.
+func (c OctaveConvention) Named() OctaveConvention {
+	switch strings.ToUpper(string(c)) {
+	case "YAMAHA", "C3":
+		return Yamaha
+	case "SCIENTIFIC", "C4":
+		return Scientific
+	case "ROLAND":
+		return Roland
+	case "C5":
+		return MiddleC5
+	default:
+		return c
+	}
+}
+
+// FormatNote writes a MIDI note number as a note name, with sharps, in the convention.
+func (c OctaveConvention) FormatNote(number int) (string, error) {
+	octave, err := c.Octave()
+	if err != nil {
+		return "", err
+	}
+	return FormatNote(number, octave), nil
+}
@@ -0,0 +1,71 @@
+package fugalist
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOctaveConvention_Octave(t *testing.T) {
+	tests := []struct {
+		convention OctaveConvention
+		octave     int
+		ok         bool
+	}{
+		{"", 4, true},
+		{Yamaha, 3, true},
+		{Scientific, 4, true},
+		{Roland, 4, true},
+		{MiddleC5, 5, true},
+		{"yamaha", 3, true},
+		{"C3", 3, true},
+		{"c3", 3, true},
+		{"C4", 4, true},
+		{"4", 0, false},
+		{"C6", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(string(test.convention), func(t *testing.T) {
+			octave, err := test.convention.Octave()
+			assert.Equal(t, test.ok, err == nil)
+			assert.Equal(t, test.octave, octave)
+		})
+	}
+}
+
+func TestOctaveConvention_Named(t *testing.T) {
+	tests := []struct {
+		convention OctaveConvention
+		named      OctaveConvention
+	}{
+		{"", ""},
+		{"C3", Yamaha},
+		{"c4", Scientific},
+		{"C5", MiddleC5},
+		{"roland", Roland},
+		{Yamaha, Yamaha},
+		{"C6", "C6"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.convention), func(t *testing.T) {
+			assert.Equal(t, test.named, test.convention.Named())
+		})
+	}
+}
+
+func TestOctaveConvention_FormatNote(t *testing.T) {
+	note, err := Yamaha.FormatNote(61)
+	assert.Nil(t, err)
+	assert.Equal(t, "C#3", note)
+	note, err = Roland.FormatNote(61)
+	assert.Nil(t, err)
+	assert.Equal(t, "C#4", note)
+	_, err = OctaveConvention("middle").FormatNote(61)
+	assert.NotNil(t, err)
+}
+
+func TestParseActionList_UnknownConvention(t *testing.T) {
+	_, err := ParseActionList("C3", "C9", nil, nil)
+	assert.NotNil(t, err)
+	_, err = ParsePitch("C3", "C9")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,229 @@
+package fugalist
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseError is a syntax error located in the text being parsed, so that an editor can
+// underline the offending token.
+type ParseError struct {
+	// Offset is the byte offset of Token in the text.
+	Offset int
+	// Token is the text found at Offset, or "" at the end of the text.
+	Token string
+	// Length is the length of Token.
+	Length int
+	// Expected lists the alternatives that would have been accepted at Offset.
+	Expected []string
+	// Err, if not nil, is what is wrong with Token, which was read but could not be used:
+	// a reference to a bad macro, for instance. Expected is then empty.
+	Err error
+
+	// remaining is the length of the text from Offset on, which is all a parser working
+	// on a suffix of the text knows.
+	remaining int
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("at offset %d: %s", e.Offset, e.describe())
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// describe says what is wrong, without saying where.
+func (e *ParseError) describe() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	found := "end of input"
+	if e.Token != "" {
+		found = strconv.Quote(e.Token)
+	}
+	return fmt.Sprintf("expected %s, found %s", strings.Join(e.Expected, " or "), found)
+}
+
+var tokenRegexp = regexp.MustCompile(`^(\w+|[<>=!]=?|\S)`)
+
+// token returns the token at the start of the input.
+func (in Input) token() string {
+	return tokenRegexp.FindString(string(in))
+}
+
+// expected returns a ParseError for the token at the start of the input, after whitespace.
+func (in Input) expected(alternatives ...string) error {
+	inp := in.SkipWhitespace()
+	token := inp.token()
+	return &ParseError{
+		Token:     token,
+		Length:    len(token),
+		Expected:  alternatives,
+		remaining: len(inp),
+	}
+}
+
+// locate sets the offset of a ParseError raised while parsing a suffix of text. Other
+// errors are returned unchanged.
+func locate(err error, text Input) error {
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		perr.Offset = len(text) - perr.remaining
+	}
+	return err
+}
+
+// furthest returns whichever of two ParseErrors got further into the text, merging their
+// alternatives if they got equally far. If only one of them is a ParseError, it returns the
+// other, which is the more specific.
+func furthest(a error, b error) error {
+	var x, y *ParseError
+	if !errors.As(a, &x) {
+		return a
+	}
+	if !errors.As(b, &y) {
+		return b
+	}
+	switch {
+	case x.remaining < y.remaining:
+		return x
+	case y.remaining < x.remaining:
+		return y
+	}
+	merged := *x
+	merged.Expected = append([]string{}, x.Expected...)
+	for _, alternative := range y.Expected {
+		if !contains(merged.Expected, alternative) {
+			merged.Expected = append(merged.Expected, alternative)
+		}
+	}
+	return &merged
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// syntaxStep is one element of a notation: a regular expression, which may capture and
+// brings its own leading whitespace, and the name of what it reads.
+type syntaxStep struct {
+	re       string
+	name     string
+	optional bool
+}
+
+func step(re string, name string) syntaxStep {
+	return syntaxStep{re: re, name: name}
+}
+
+// optional returns a step that may be left out. Consecutive optional steps are left out
+// together.
+func optional(re string, name string) syntaxStep {
+	return syntaxStep{re: re, name: name, optional: true}
+}
+
+// syntax describes a notation, such as "CCn=v", as a sequence of steps. The description
+// gives both the pattern that reads the notation and the tokens expected where a string
+// that starts out in the notation goes wrong.
+type syntax struct {
+	// summary names the notation in errors about strings that match none of its steps.
+	summary []string
+	steps   []syntaxStep
+	// lead is how many steps a string must match before the syntax explains its error: 2
+	// for a notation that starts with any word.
+	lead int
+	// pattern matches the whole notation, capturing what its steps capture.
+	pattern *regexp.Regexp
+	res     []*regexp.Regexp
+}
+
+func newSyntax(summary []string, steps ...syntaxStep) *syntax {
+	x := &syntax{summary: summary, steps: steps, lead: 1}
+	var sb strings.Builder
+	sb.WriteString(`^\s*`)
+	for k, st := range steps {
+		if st.optional && (k == 0 || !steps[k-1].optional) {
+			sb.WriteString(`(?:`)
+		}
+		sb.WriteString(st.re)
+		if st.optional && (k == len(steps)-1 || !steps[k+1].optional) {
+			sb.WriteString(`)?`)
+		}
+		x.res = append(x.res, regexp.MustCompile(`^(?:`+st.re+`)`))
+	}
+	sb.WriteString(`\s*$`)
+	x.pattern = regexp.MustCompile(sb.String())
+	return x
+}
+
+// afterWord makes a syntax that starts with any word explain only the errors of strings that
+// get past the word.
+func (x *syntax) afterWord() *syntax {
+	x.lead = 2
+	return x
+}
+
+// explain returns a ParseError after the longest prefix of s, without leading whitespace,
+// that follows the syntax, or nil if s doesn't get past the syntax's lead steps or follows
+// it completely.
+func (x *syntax) explain(s string, end string) error {
+	rest := Input(s).SkipWhitespace()
+	matched, last := 0, -1
+	expected := make([]string, 0)
+	for k := 0; k < len(x.steps); k++ {
+		st := x.steps[k]
+		if loc := x.res[k].FindStringIndex(string(rest)); loc != nil {
+			rest = rest[loc[1]:]
+			matched, last = matched+1, k
+			expected = expected[:0]
+			continue
+		}
+		// Once an optional group has started, the rest of it is required.
+		inGroup := k > 0 && st.optional && x.steps[k-1].optional && last == k-1
+		if !st.optional || inGroup {
+			if matched < x.lead {
+				return nil
+			}
+			return rest.expected(append(expected, st.name)...)
+		}
+		// Skip the rest of the optional group.
+		expected = append(expected, st.name)
+		for k+1 < len(x.steps) && x.steps[k+1].optional {
+			k++
+		}
+	}
+	if matched < x.lead || rest.Empty() {
+		return nil
+	}
+	return rest.expected(append(expected, end)...)
+}
+
+// syntaxError locates the error in a string that none of syntaxes reads: after the longest
+// prefix that one of them explains, or else at its start.
+func syntaxError(s string, end string, syntaxes []*syntax) error {
+	var result error
+	expected := make([]string, 0)
+	for _, x := range syntaxes {
+		expected = append(expected, x.summary...)
+		if err := x.explain(s, end); err != nil {
+			if result == nil {
+				result = err
+			} else {
+				result = furthest(result, err)
+			}
+		}
+	}
+	if result == nil {
+		result = Input(s).expected(expected...)
+	}
+	return locate(result, Input(s))
+}
@@ -0,0 +1,111 @@
+package fugalist
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseError_BranchConditions(t *testing.T) {
+	tests := []struct {
+		in       string
+		offset   int
+		token    string
+		expected []string
+	}{
+		{"nl < short or", 13, "", []string{"NOT", "(", "veryShort", "short", "medium", "long", "veryLong", "NoteLength"}},
+		{"nl < shrt", 5, "shrt", []string{"veryShort", "short", "medium", "long", "veryLong"}},
+		{"nl < short nl > long", 11, "nl", []string{"AND", "OR"}},
+		{"(nl < short", 11, "", []string{"AND", "OR", ")"}},
+		{"short <= nl < ", 12, "<", []string{"AND", "OR"}},
+		{"short nl", 6, "nl", []string{"<", "<=", ">", ">=", "==", "!="}},
+		{"  ornament < short", 2, "ornament", []string{"NOT", "(", "veryShort", "short", "medium", "long", "veryLong", "NoteLength"}},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			_, err := Input(test.in).ParseBranchConditions()
+			var perr *ParseError
+			assert.True(t, errors.As(err, &perr))
+			assert.Equal(t, test.offset, perr.Offset)
+			assert.Equal(t, test.token, perr.Token)
+			assert.Equal(t, test.expected, perr.Expected)
+		})
+	}
+}
+
+func TestParseError_BranchCondition(t *testing.T) {
+	_, err := Input("nl < short and nl >").ParseBranchCondition()
+	var perr *ParseError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, 19, perr.Offset)
+	assert.Equal(t, `at offset 19: expected veryShort or short or medium or long or veryLong, found end of input`, err.Error())
+}
+
+func TestParseError_ActionList(t *testing.T) {
+	tests := []struct {
+		in       string
+		offset   int
+		token    string
+		expected []string
+	}{
+		{"CC1=2, CC3=", 11, "", []string{"value"}},
+		{"KS3, xyz", 5, "xyz", []string{"CCn=v", "CC14:n=v", "CCn=v/d", "KSn", "PCn", "PB=v", "AT=v", "CHn", "NRPNn=v", "RPNn=v", "note", "controller=v"}},
+		{"KS3, Fx", 6, "x", []string{"accidental", "octave"}},
+		{"C3,Q", 3, "Q", []string{"CCn=v", "CC14:n=v", "CCn=v/d", "KSn", "PCn", "PB=v", "AT=v", "CHn", "NRPNn=v", "RPNn=v", "note", "controller=v"}},
+		{"NRPN12=", 7, "", []string{"value"}},
+		{"PB 5", 3, "5", []string{"="}},
+		{"PC 7 9", 5, "9", []string{"end of action"}},
+		{"CC1=2/x", 6, "x", []string{"denominator"}},
+		{"Eb3=x", 4, "x", []string{"velocity"}},
+		{"C#3 4", 4, "4", []string{"=", "end of action"}},
+		{"CC14:x", 5, "x", []string{"controller number"}},
+		{"KS60=", 5, "", []string{"velocity"}},
+		{"CC1=2 x", 6, "x", []string{"end of action", "/"}},
+		{"breath=", 7, "", []string{"value"}},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			_, err := ParseSwitchOnActionList(test.in, "C3", nil, nil)
+			var perr *ParseError
+			assert.True(t, errors.As(err, &perr))
+			assert.Equal(t, test.offset, perr.Offset)
+			assert.Equal(t, test.token, perr.Token)
+			assert.Equal(t, test.expected, perr.Expected)
+		})
+	}
+}
+
+func TestFurthest(t *testing.T) {
+	near := Input("a b").expected("x")
+	far := Input("b").expected("y")
+	other := errors.New("out of range")
+	assert.Equal(t, far, furthest(near, far))
+	assert.Equal(t, far, furthest(far, near))
+	assert.Equal(t, other, furthest(near, other))
+	assert.Equal(t, other, furthest(other, far))
+}
+
+func TestParseError_VolumeSpec(t *testing.T) {
+	tests := []struct {
+		in       string
+		offset   int
+		token    string
+		expected []string
+	}{
+		{"loudness", 0, "loudness", []string{"velocity", "CCn", "controller"}},
+		{"CC", 2, "", []string{"controller number"}},
+		{"CC11 0:", 7, "", []string{"maximum"}},
+		{"velocity 0 127", 11, "127", []string{":"}},
+		{"velocity 0:127 x", 15, "x", []string{"end of input"}},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			_, _, err := ParseVolumeSpec(test.in, nil)
+			var perr *ParseError
+			assert.True(t, errors.As(err, &perr))
+			assert.Equal(t, test.offset, perr.Offset)
+			assert.Equal(t, test.token, perr.Token)
+			assert.Equal(t, test.expected, perr.Expected)
+		})
+	}
+}
@@ -10,8 +10,8 @@ import (
 	"strings"
 )
 
-func ParseSwitchOnActionList(s string, middleC string) (*doricolib.SwitchOnActionList, error) {
-	actions, err := ParseActionList(s, middleC)
+func ParseSwitchOnActionList(s string, middleC OctaveConvention, macros Macros, controllers Controllers) (*doricolib.SwitchOnActionList, error) {
+	actions, err := ParseActionList(s, middleC, macros, controllers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse start-action list: %w", err)
 	}
@@ -21,8 +21,8 @@ func ParseSwitchOnActionList(s string, middleC string) (*doricolib.SwitchOnActio
 	}, nil
 }
 
-func ParseSwitchOffActionList(s string, middleC string) (*doricolib.SwitchOffActionList, error) {
-	actions, err := ParseActionList(s, middleC)
+func ParseSwitchOffActionList(s string, middleC OctaveConvention, macros Macros, controllers Controllers) (*doricolib.SwitchOffActionList, error) {
+	actions, err := ParseActionList(s, middleC, macros, controllers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse stop-action list: %w", err)
 	}
@@ -32,94 +32,105 @@ func ParseSwitchOffActionList(s string, middleC string) (*doricolib.SwitchOffAct
 	}, nil
 }
 
-func ParseActionList(s string, middleC string) ([]doricolib.SwitchAction, error) {
-	c := 4
-	switch middleC {
-	case "C3", "c3":
-		c = 3
-	case "C4", "c4":
-		c = 4
-	case "C5", "c5":
-		c = 5
-	}
-	parts := strings.Split(s, ",")
-	actions := make([]doricolib.SwitchAction, 0)
-	for _, part := range parts {
-		action, err := ParseMidi(part, c)
-		if err != nil {
-			return nil, err
-		}
-		if action != nil {
-			actions = append(actions, *action)
-		}
+func ParseActionList(s string, middleC OctaveConvention, macros Macros, controllers Controllers) ([]doricolib.SwitchAction, error) {
+	octave, err := middleC.Octave()
+	if err != nil {
+		return nil, err
 	}
-	return actions, nil
+	actions, _, err := parseActionNotation(s, octave, macros, controllers, nil)
+	return actions, err
 }
 
-var EmptyPat = regexp.MustCompile(`^\s*$`)
-var CcPat = regexp.MustCompile(`^\s*(?i:CC)\s*(\d+)\s*=\s*(\d+)\s*$`)
-var CCPartPat = regexp.MustCompile(`^\s*(?i:CC)\s*(\d+)\s*=\s*(\d+)\/(\d+)\s*$`)
-var KsPat = regexp.MustCompile(`^\s*(?i:KS)\s*(\d+)\s*(?:=\s*(\d+))?\s*$`)
-var PcPat = regexp.MustCompile(`^\s*(?i:PC)\s*(\d+)\s*$`)
-var NotePat = regexp.MustCompile(`^\s*([A-Ga-g])([#b]?)\s*(-?\d+)\s*$`)
+// Switch action types that Dorico lacks. Only the DAW exporters can play them.
+const (
+	// ActionPitchBend has the 14-bit bend, 0 to 16383 with 8192 at the center, as Param1.
+	ActionPitchBend = "kPitchBend"
+	// ActionChannelPressure has the pressure as Param1.
+	ActionChannelPressure = "kChannelPressure"
+)
 
-func ParseMidi(part string, middleCOctave int) (*doricolib.SwitchAction, error) {
-	switch {
-	case EmptyPat.MatchString(part):
-		return nil, nil
-	case CcPat.MatchString(part):
-		x := CcPat.FindStringSubmatch(part)
-		return &doricolib.SwitchAction{
-			Type:   "kControlChange",
-			Param1: x[1],
-			Param2: x[2],
-		}, nil
-	case CCPartPat.MatchString(part):
-		x := CCPartPat.FindStringSubmatch(part)
-		setting, err := proportion(x[2], x[3])
-		if err != nil {
-			return nil, fmt.Errorf("bad CC")
-		}
-		return &doricolib.SwitchAction{
-			Type:   "kControlChange",
-			Param1: x[0],
-			Param2: setting,
-		}, nil
-	case KsPat.MatchString(part):
-		x := KsPat.FindStringSubmatch(part)
-		vel := "127"
-		if x[2] != "" {
-			vel = x[2]
-		}
-		return &doricolib.SwitchAction{
-			Type:   "kKeySwitch",
-			Param1: x[1],
-			Param2: vel,
-		}, nil
-	case PcPat.MatchString(part):
-		x := PcPat.FindStringSubmatch(part)
-		return &doricolib.SwitchAction{
-			Type:   "kProgramChange",
-			Param1: x[1],
-			Param2: "0",
-		}, nil
-	case NotePat.MatchString(part):
-		x := NotePat.FindStringSubmatch(part)
-		number, err := note(x[1], x[2], x[3], middleCOctave)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse midi: %v", part)
-		}
-		return &doricolib.SwitchAction{
-			Type:   "kKeySwitch",
-			Param1: strconv.Itoa(number),
-			Param2: "127",
-		}, nil
+// Dorico's channel change actions, which send the actions and notes that follow on another
+// channel.
+const (
+	// ActionAbsoluteChannel has the channel, 0 to 15, as Param1.
+	ActionAbsoluteChannel = "kAbsoluteChannelChange"
+	// ActionRelativeChannel has the signed offset from the instrument's channel as Param1.
+	ActionRelativeChannel = "kRelativeChannelChange"
+)
 
-	default:
-		return nil, fmt.Errorf("illegal midi setting: \"%v\"", part)
+var nrpnSyntax = newSyntax([]string{"NRPNn=v", "RPNn=v"},
+	step(`(?i:(N?RPN))`, "NRPN"), step(`\s*(\d+)`, "parameter number"), step(`\s*=`, "="), step(`\s*(\d+)`, "value"))
+var cc14Syntax = newSyntax([]string{"CC14:n=v"},
+	step(`(?i:CC14)`, "CC14"), step(`\s*:`, ":"), step(`\s*(\d+)`, "controller number"), step(`\s*=`, "="), step(`\s*(\d+)`, "value"))
+
+var NrpnPat = nrpnSyntax.pattern
+var Cc14Pat = cc14Syntax.pattern
+
+// ParseMidiActions parses one element of an action list with the first of ActionCodecs
+// that reads it. NRPN and RPN messages such as "NRPN300=1000" and 14-bit controllers such
+// as "CC14:1=9000" (CC1 and CC33) expand into the control changes that send them. Only the
+// standard controller aliases are understood.
+func ParseMidiActions(part string, middleCOctave int) ([]doricolib.SwitchAction, error) {
+	actions, _, err := parseActionPart(part, middleCOctave, nil)
+	return actions, err
+}
+
+func parse14Bit(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n > 16383 {
+		return 0, fmt.Errorf("out of range 0..16383: %s", s)
+	}
+	return n, nil
+}
+
+// controlChanges14 sends a 14-bit value as a pair of control changes, most significant
+// byte first.
+func controlChanges14(msb int, lsb int, value int) []doricolib.SwitchAction {
+	return []doricolib.SwitchAction{
+		{Type: "kControlChange", Param1: strconv.Itoa(msb), Param2: strconv.Itoa(value >> 7)},
+		{Type: "kControlChange", Param1: strconv.Itoa(lsb), Param2: strconv.Itoa(value & 127)},
 	}
 }
 
+var EmptyPat = regexp.MustCompile(`^\s*$`)
+
+var ccSyntax = newSyntax([]string{"CCn=v"},
+	step(`(?i:CC)`, "CC"), step(`\s*(\d+)`, "controller number"), step(`\s*=`, "="), step(`\s*(\d+)`, "value"))
+var ccFractionSyntax = newSyntax([]string{"CCn=v/d"},
+	step(`(?i:CC)`, "CC"), step(`\s*(\d+)`, "controller number"), step(`\s*=`, "="), step(`\s*(\d+)`, "value"),
+	step(`/`, "/"), step(`(\d+)`, "denominator"))
+var ksSyntax = newSyntax([]string{"KSn"},
+	step(`(?i:KS)`, "KS"), step(`\s*(\d+)`, "note number"), optional(`\s*=`, "="), optional(`\s*(\d+)`, "velocity"))
+var pcSyntax = newSyntax([]string{"PCn"}, step(`(?i:PC)`, "PC"), step(`\s*(\d+)`, "program number"))
+var pbSyntax = newSyntax([]string{"PB=v"}, step(`(?i:PB)`, "PB"), step(`\s*=`, "="), step(`\s*(-?\d+)`, "value"))
+var atSyntax = newSyntax([]string{"AT=v"}, step(`(?i:AT)`, "AT"), step(`\s*=`, "="), step(`\s*(\d+)`, "value"))
+var chSyntax = newSyntax([]string{"CHn"}, step(`(?i:CH)`, "CH"), step(`\s*([+-]?)`, "sign"), step(`\s*(\d+)`, "channel"))
+
+// accidentals are the sharps and flats a note name may carry, longest first.
+const accidentals = `##|bb|♯♯|♭♭|𝄪|𝄫|#|b|♯|♭`
+
+var noteSteps = []syntaxStep{step(`([A-Ga-g])`, "note"), optional(`(`+accidentals+`)`, "accidental"), step(`\s*(-?\d+)`, "octave")}
+var noteSyntax = newSyntax([]string{"note"}, noteSteps...)
+var noteVelocitySyntax = newSyntax([]string{"note"}, append(noteSteps, optional(`\s*=`, "="), optional(`\s*(\d+)`, "velocity"))...)
+var aliasSyntax = newSyntax([]string{"controller=v"},
+	step(`([A-Za-z_]+)`, "controller"), step(`\s*=`, "="), step(`\s*(\d+)`, "value")).afterWord()
+
+// actionSyntaxes are the notations of a single action, in the order errors name them.
+var actionSyntaxes = []*syntax{
+	ccSyntax, cc14Syntax, ccFractionSyntax, ksSyntax, pcSyntax, pbSyntax, atSyntax, chSyntax, nrpnSyntax, noteVelocitySyntax, aliasSyntax,
+}
+
+var CcPat = ccSyntax.pattern
+var CCPartPat = ccFractionSyntax.pattern
+var KsPat = ksSyntax.pattern
+var PcPat = pcSyntax.pattern
+var NotePat = noteSyntax.pattern
+var NoteVelocityPat = noteVelocitySyntax.pattern
+var AliasPat = aliasSyntax.pattern
+var PbPat = pbSyntax.pattern
+var AtPat = atSyntax.pattern
+var ChPat = chSyntax.pattern
+
 func proportion(num string, den string) (string, error) {
 	n, err := strconv.ParseFloat(num, 64)
 	if err != nil {
@@ -146,10 +157,14 @@ func note(name, sharpOrFlat, octave string, middleCOctave int) (int, error) {
 		return -1, err
 	}
 	switch sharpOrFlat {
-	case "#":
+	case "#", "♯":
 		noteNumber++
-	case "b":
+	case "##", "♯♯", "𝄪":
+		noteNumber += 2
+	case "b", "♭":
 		noteNumber--
+	case "bb", "♭♭", "𝄫":
+		noteNumber -= 2
 	}
 
 	oct, err := strconv.Atoi(octave)
@@ -180,6 +195,71 @@ func noteNumber(noteName string) (int, error) {
 	}
 }
 
+var MidiNotePat = regexp.MustCompile(`^\s*(\d+)\s*$`)
+
+// ParsePitch parses a MIDI note number or a note name such as "C#2".
+func ParsePitch(s string, middleC OctaveConvention) (int, error) {
+	var number int
+	var err error
+	switch {
+	case MidiNotePat.MatchString(s):
+		number, err = strconv.Atoi(MidiNotePat.FindStringSubmatch(s)[1])
+	case NotePat.MatchString(s):
+		x := NotePat.FindStringSubmatch(s)
+		var octave int
+		octave, err = middleC.Octave()
+		if err != nil {
+			return 0, err
+		}
+		number, err = note(x[1], x[2], x[3], octave)
+	default:
+		return 0, fmt.Errorf("bad pitch: %q", s)
+	}
+	if err != nil || number < 0 || number > 127 {
+		return 0, fmt.Errorf("bad pitch: %q", s)
+	}
+	return number, nil
+}
+
+// ParsePitchRange parses a pitch range such as "C1:B6" or "36:95" into a Dorico pitch range
+// such as "36,95". An empty range is the whole keyboard.
+func ParsePitchRange(s string, middleC OctaveConvention) (string, error) {
+	if EmptyPat.MatchString(s) {
+		return "0,127", nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("bad pitch range: %q", s)
+	}
+	lo, err := ParsePitch(parts[0], middleC)
+	if err != nil {
+		return "", fmt.Errorf("bad pitch range: %w", err)
+	}
+	hi, err := ParsePitch(parts[1], middleC)
+	if err != nil {
+		return "", fmt.Errorf("bad pitch range: %w", err)
+	}
+	if lo > hi {
+		return "", fmt.Errorf("bad pitch range: %q is empty", s)
+	}
+	return fmt.Sprintf("%d,%d", lo, hi), nil
+}
+
+var AttackPattern = regexp.MustCompile(`^\s*(?:(?i:velocity)|(?i:cc)\s*(\d+))?\s*$`)
+
+// ParseAttackSpec parses what controls the attack of a note: "velocity" (the default) or
+// "CCn".
+func ParseAttackSpec(s string) (*doricolib.AttackType, error) {
+	if !AttackPattern.MatchString(s) {
+		return nil, fmt.Errorf("bad attack: %q", s)
+	}
+	cc := AttackPattern.FindStringSubmatch(s)[1]
+	if cc == "" {
+		return &doricolib.AttackType{Type: "kNoteVelocity", Param1: "0"}, nil
+	}
+	return &doricolib.AttackType{Type: "kCC", Param1: cc}, nil
+}
+
 var transposePattern = regexp.MustCompile(`^\s+([+-]?)(\d+)\s*$`)
 
 func ParseTranspose(t string) (int, error) {
@@ -201,29 +281,53 @@ func ParseTranspose(t string) (int, error) {
 //   Velocity min:max
 //
 var EmptyPattern = regexp.MustCompile(`^\s*$`)
-var CcPattern = regexp.MustCompile(`^\s*(?i:cc)\s*(\d+)(?:\s+(?:(\d+)\s*:\s*(\d+)))?\s*$`)
-var VelPattern = regexp.MustCompile(`^\s*(?i:velocity)\s*(?:\s+(?:(\d+)\s*:\s*(\d+)))?\s*$`)
 
-func ParseVolumeSpec(s string) (*doricolib.VolumeType, string, error) {
+var volumeRangeSteps = []syntaxStep{optional(`\s+(\d+)`, "minimum"), optional(`\s*:`, ":"), optional(`\s*(\d+)`, "maximum")}
+var velocitySyntax = newSyntax([]string{"velocity"}, append([]syntaxStep{step(`(?i:velocity)`, "velocity")}, volumeRangeSteps...)...)
+var ccVolumeSyntax = newSyntax([]string{"CCn"}, append([]syntaxStep{step(`(?i:cc)`, "CC"), step(`\s*(\d+)`, "controller number")}, volumeRangeSteps...)...)
+var aliasVolumeSyntax = newSyntax([]string{"controller"}, append([]syntaxStep{step(`([A-Za-z_]+)`, "controller")}, volumeRangeSteps...)...).afterWord()
+
+// volumeSyntaxes are the notations of a volume spec, in the order errors name them.
+var volumeSyntaxes = []*syntax{velocitySyntax, ccVolumeSyntax, aliasVolumeSyntax}
+
+var CcPattern = ccVolumeSyntax.pattern
+var VelPattern = velocitySyntax.pattern
+var AliasPattern = aliasVolumeSyntax.pattern
+
+// ParseVolumeSpec parses a dynamics spec: "velocity", "CC11 0:100" or, with a controller
+// alias, "expression 0:100".
+func ParseVolumeSpec(s string, controllers Controllers) (*doricolib.VolumeType, string, error) {
+	var volumeType *doricolib.VolumeType
+	var limits []string
 	switch {
 	case EmptyPattern.MatchString(s):
-		return &doricolib.VolumeType{
-			Type:   "kNoteVelocity",
-			Param1: "0",
-		}, "0,127", nil
+		volumeType, limits = &doricolib.VolumeType{Type: "kNoteVelocity", Param1: "0"}, []string{""}
 	case CcPattern.MatchString(s):
 		parts := CcPattern.FindStringSubmatch(s)
-		return &doricolib.VolumeType{
-			Type:   "kCC",
-			Param1: parts[1],
-		}, rangeString(parts[2:]), nil
+		volumeType, limits = &doricolib.VolumeType{Type: "kCC", Param1: parts[1]}, parts[2:]
 	case VelPattern.MatchString(s):
 		parts := VelPattern.FindStringSubmatch(s)
-		return &doricolib.VolumeType{
-			Type:   "kNoteVelocity",
-			Param1: "0",
-		}, rangeString(parts[1:]), nil
+		volumeType, limits = &doricolib.VolumeType{Type: "kNoteVelocity", Param1: "0"}, parts[1:]
+	case AliasPattern.MatchString(s):
+		parts := AliasPattern.FindStringSubmatch(s)
+		number, ok := controllers.Controller(parts[1])
+		if !ok {
+			return nil, "", syntaxError(s, "end of input", volumeSyntaxes)
+		}
+		volumeType, limits = &doricolib.VolumeType{Type: "kCC", Param1: strconv.Itoa(number)}, parts[2:]
 	default:
-		return nil, "", errors.New("bad velocity pattern")
+		return nil, "", syntaxError(s, "end of input", volumeSyntaxes)
+	}
+	r := rangeString(limits)
+	lo, hi, err := splitRange(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if hi > 127 {
+		return nil, "", fmt.Errorf("dynamics range out of range 0..127: %d:%d", lo, hi)
+	}
+	if lo > hi {
+		return nil, "", fmt.Errorf("dynamics range is reversed: %d:%d", lo, hi)
 	}
+	return volumeType, r, nil
 }
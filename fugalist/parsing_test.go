@@ -52,6 +52,8 @@ func TestNoteParser(t *testing.T) {
 		{"d#3", []string{"d", "#", "3"}},
 		{"d#-1", []string{"d", "#", "-1"}},
 		{"db -1", []string{"d", "b", "-1"}},
+		{"Ebb2", []string{"E", "bb", "2"}},
+		{"F♯4", []string{"F", "♯", "4"}},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -135,12 +137,17 @@ func TestParseVolumeSpec(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			vt, rng, err := ParseVolumeSpec(test.input)
+			vt, rng, err := ParseVolumeSpec(test.input, nil)
 			assert.Nil(t, err)
 			assert.Equal(t, test.expectedVolType, vt)
 			assert.Equal(t, test.expectedRange, rng)
 		})
 	}
+
+	for _, bad := range []string{"CC1 200:100", "velocity 0:128", "velocity 90:10"} {
+		_, _, err := ParseVolumeSpec(bad, nil)
+		assert.NotNil(t, err, bad)
+	}
 }
 
 func TestNote(t *testing.T) {
@@ -189,21 +196,123 @@ func TestCCMidiAction(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    string
-		expected *doricolib.SwitchAction
+		expected doricolib.SwitchAction
 	}{
-		{"lower case", "cc3=12", &doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "12"}},
-		{"upper case", "CC3=12", &doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "12"}},
-		{"spaces", " CC 3 = 12 ", &doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "12"}},
-		{"spaces", " CC3=1/4", &doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "16"}},
-		{"spaces", " CC3=2/4", &doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "48"}},
-		{"spaces", " CC3=3/4", &doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "80"}},
-		{"spaces", " CC3=4/4", &doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "112"}},
+		{"lower case", "cc3=12", doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "12"}},
+		{"upper case", "CC3=12", doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "12"}},
+		{"spaces", " CC 3 = 12 ", doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "12"}},
+		{"spaces", " CC3=1/4", doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "16"}},
+		{"spaces", " CC3=2/4", doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "48"}},
+		{"spaces", " CC3=3/4", doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "80"}},
+		{"spaces", " CC3=4/4", doricolib.SwitchAction{Type: "kControlChange", Param1: "3", Param2: "112"}},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			action, err := ParseMidi(test.input, 4)
+			actions, err := ParseMidiActions(test.input, 4)
 			assert.Nil(t, err)
-			assert.Equal(t, test.expected, action)
+			assert.Equal(t, []doricolib.SwitchAction{test.expected}, actions)
+		})
+	}
+}
+
+func TestParsePitchRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		middleC  OctaveConvention
+		expected string
+		err      bool
+	}{
+		{"empty", "", "C4", "0,127", false},
+		{"numbers", "36:95", "C4", "36,95", false},
+		{"notes", "C2:B6", "C4", "36,95", false},
+		{"notes C3", "C1:B5", "C3", "36,95", false},
+		{"notes C5", "C3:B7", "C5", "36,95", false},
+		{"sharp and space", " C#2 : 100 ", "C4", "37,100", false},
+		{"single note", "C4:C4", "C4", "60,60", false},
+		{"reversed", "C4:C2", "C4", "", true},
+		{"too high", "0:128", "C4", "", true},
+		{"below keyboard", "C-2:C4", "C4", "", true},
+		{"one note", "C4", "C4", "", true},
+		{"garbage", "low:high", "C4", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParsePitchRange(test.input, test.middleC)
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseMidiActions(t *testing.T) {
+	cc := func(controller string, value string) doricolib.SwitchAction {
+		return doricolib.SwitchAction{Type: "kControlChange", Param1: controller, Param2: value}
+	}
+	tests := []struct {
+		name     string
+		input    string
+		expected []doricolib.SwitchAction
+		err      bool
+	}{
+		{"NRPN", "NRPN300=1000", []doricolib.SwitchAction{cc("99", "2"), cc("98", "44"), cc("6", "7"), cc("38", "104")}, false},
+		{"RPN", " rpn 0 = 256 ", []doricolib.SwitchAction{cc("101", "0"), cc("100", "0"), cc("6", "2"), cc("38", "0")}, false},
+		{"14-bit CC", "CC14:1=9000", []doricolib.SwitchAction{cc("1", "70"), cc("33", "40")}, false},
+		{"pitch bend", "PB=-8192", []doricolib.SwitchAction{{Type: ActionPitchBend, Param1: "0"}}, false},
+		{"pitch bend up", "pb = 8191", []doricolib.SwitchAction{{Type: ActionPitchBend, Param1: "16383"}}, false},
+		{"channel pressure", "AT=90", []doricolib.SwitchAction{{Type: ActionChannelPressure, Param1: "90"}}, false},
+		{"plain CC", "CC14=5", []doricolib.SwitchAction{cc("14", "5")}, false},
+		{"channel", "CH3", []doricolib.SwitchAction{{Type: ActionAbsoluteChannel, Param1: "2"}}, false},
+		{"channel 16", " ch 16 ", []doricolib.SwitchAction{{Type: ActionAbsoluteChannel, Param1: "15"}}, false},
+		{"channel up", "CH+2", []doricolib.SwitchAction{{Type: ActionRelativeChannel, Param1: "2"}}, false},
+		{"channel down", "CH - 1", []doricolib.SwitchAction{{Type: ActionRelativeChannel, Param1: "-1"}}, false},
+		{"channel out of range", "CH17", nil, true},
+		{"channel zero", "CH0", nil, true},
+		{"relative channel out of range", "CH+16", nil, true},
+		{"empty", " ", nil, false},
+		{"NRPN out of range", "NRPN16384=0", nil, true},
+		{"14-bit controller out of range", "CC14:32=0", nil, true},
+		{"pitch bend out of range", "PB=8192", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParseMidiActions(test.input, 4)
+			if test.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestParseAttackSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected *doricolib.AttackType
+	}{
+		{"empty", "", &doricolib.AttackType{Type: "kNoteVelocity", Param1: "0"}},
+		{"velocity", " Velocity ", &doricolib.AttackType{Type: "kNoteVelocity", Param1: "0"}},
+		{"CC", "CC2", &doricolib.AttackType{Type: "kCC", Param1: "2"}},
+		{"cc with space", " cc 11 ", &doricolib.AttackType{Type: "kCC", Param1: "11"}},
+		{"range", "velocity 0:127", nil},
+		{"garbage", "breath", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParseAttackSpec(test.input)
+			if test.expected == nil {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expected, actual)
+			}
 		})
 	}
 }
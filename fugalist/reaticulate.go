@@ -0,0 +1,111 @@
+package fugalist
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"strconv"
+	"strings"
+)
+
+// Reaticulate has four articulation groups and one program per articulation.
+const (
+	reaticulateGroups   = 4
+	reaticulatePrograms = 128
+)
+
+// ReaticulateOutputEvent converts a Dorico switch action into a Reaticulate output event
+// such as "note:24,127", "cc:1,64" or "program:3".
+func ReaticulateOutputEvent(action doricolib.SwitchAction) (string, error) {
+	switch action.Type {
+	case "kKeySwitch":
+		return fmt.Sprintf("note:%s,%s", action.Param1, action.Param2), nil
+	case "kControlChange":
+		return fmt.Sprintf("cc:%s,%s", action.Param1, action.Param2), nil
+	case "kProgramChange":
+		return fmt.Sprintf("program:%s", action.Param1), nil
+	case ActionAbsoluteChannel:
+		channel, err := strconv.Atoi(action.Param1)
+		if err != nil {
+			return "", fmt.Errorf("bad %s parameter: %s", action.Type, action.Param1)
+		}
+		return fmt.Sprintf("@%d", channel+1), nil
+	case ActionPitchBend:
+		bend, err := strconv.Atoi(action.Param1)
+		if err != nil {
+			return "", fmt.Errorf("bad %s parameter: %s", action.Type, action.Param1)
+		}
+		return fmt.Sprintf("pitch:%d", bend-8192), nil
+	default:
+		return "", fmt.Errorf("no Reaticulate equivalent for %s", action.Type)
+	}
+}
+
+func reaticulateOutput(actions []doricolib.SwitchAction) (string, error) {
+	events := make([]string, len(actions))
+	for k, action := range actions {
+		event, err := ReaticulateOutputEvent(action)
+		if err != nil {
+			return "", err
+		}
+		events[k] = event
+	}
+	return strings.Join(events, "/"), nil
+}
+
+// reaticulateQuote makes s safe to use as a quoted Reaticulate attribute value.
+func reaticulateQuote(s string) string {
+	return strings.ReplaceAll(s, `"`, `'`)
+}
+
+// CreateReabank creates a Reaticulate bank (.reabank) for the project: one program per
+// assigned combination, numbered in combination order, in the group of its axis.
+// Composite sounds play their first branch; tints have no Reaticulate equivalent.
+func (p *Project) CreateReabank(summary ProjectSummary) ([]byte, error) {
+	articulations, err := p.Articulations()
+	if err != nil {
+		return nil, err
+	}
+	if len(articulations) > reaticulatePrograms {
+		return nil, fmt.Errorf("%d combinations: Reaticulate supports at most %d", len(articulations), reaticulatePrograms)
+	}
+	group := summary.Plugins
+	if group == "" {
+		group = "Fugalist"
+	}
+	name := strings.ReplaceAll(summary.Name, "\n", " ")
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "//! g=\"%s\" n=\"%s\"\n", reaticulateQuote(group), reaticulateQuote(name))
+	if summary.Description != "" {
+		fmt.Fprintf(&out, "//! m=\"%s\"\n", reaticulateQuote(strings.ReplaceAll(summary.Description, "\n", " ")))
+	}
+	fmt.Fprintf(&out, "Bank * * %s\n", name)
+	for program, articulation := range articulations {
+		if articulation.Group >= reaticulateGroups {
+			return nil, fmt.Errorf("%s: Reaticulate supports at most %d articulation groups", articulation.Name, reaticulateGroups)
+		}
+		output, err := reaticulateOutput(articulation.Combo.SwitchOnActions.SwitchOnActions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create articulation %s: %w", articulation.Name, err)
+		}
+		attributes := fmt.Sprintf("g=%d", articulation.Group+1)
+		if output != "" {
+			attributes += " o=" + output
+		}
+		fmt.Fprintf(&out, "//! %s\n", attributes)
+		fmt.Fprintf(&out, "%d %s\n", program, articulation.Name)
+	}
+	return out.Bytes(), nil
+}
+
+// GenerateReabank reads a project and its summary from store and creates a Reaticulate
+// bank for it.
+func GenerateReabank(ctx context.Context, store Store, pid string) ([]byte, error) {
+	project, projectSummary, err := readProjectAndSummary(ctx, store, pid)
+	if err != nil {
+		return nil, err
+	}
+	return project.CreateReabank(*projectSummary)
+}
@@ -0,0 +1,72 @@
+package fugalist
+
+import (
+	"context"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestReaticulateOutputEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   doricolib.SwitchAction
+		expected string
+		err      bool
+	}{
+		{"KS", doricolib.SwitchAction{Type: "kKeySwitch", Param1: "24", Param2: "100"}, "note:24,100", false},
+		{"CC", doricolib.SwitchAction{Type: "kControlChange", Param1: "1", Param2: "64"}, "cc:1,64", false},
+		{"PC", doricolib.SwitchAction{Type: "kProgramChange", Param1: "7", Param2: "0"}, "program:7", false},
+		{"pitch bend", doricolib.SwitchAction{Type: ActionPitchBend, Param1: "4096"}, "pitch:-4096", false},
+		{"channel pressure", doricolib.SwitchAction{Type: ActionChannelPressure, Param1: "90"}, "", true},
+		{"channel", doricolib.SwitchAction{Type: ActionAbsoluteChannel, Param1: "2"}, "@3", false},
+		{"relative channel", doricolib.SwitchAction{Type: ActionRelativeChannel, Param1: "1"}, "", true},
+		{"unknown", doricolib.SwitchAction{Type: "kBogus"}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := ReaticulateOutputEvent(test.action)
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expected, event)
+			}
+		})
+	}
+}
+
+func TestCreateReabank(t *testing.T) {
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "KS1=100, CC1=64"}
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "PC3"}
+	project := &Project{
+		Axes: map[string]Axis{
+			axis1.Id: axis1,
+			axis2.Id: axis2,
+		},
+		VstSounds: map[VstSoundId]*VstSound{legato.Id: legato, natural.Id: natural},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis1.Techniques[0].Id, axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis1.Techniques[0].Id, axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+	}
+	bank, err := project.CreateReabank(ProjectSummary{Name: "Strings", Plugins: "Kontakt"})
+	assert.Nil(t, err)
+	expected := []string{
+		`//! g="Kontakt" n="Strings"`,
+		`Bank * * Strings`,
+		`//! g=1 o=program:3`,
+		`0 Natural`,
+		`//! g=2 o=note:1,100/cc:1,64`,
+		`1 Legato`,
+		``,
+	}
+	assert.Equal(t, strings.Join(expected, "\n"), string(bank))
+}
+
+func TestGenerateReabank(t *testing.T) {
+	bank, err := GenerateReabank(context.Background(), NewFileStore("test_input", "fred"), "ParseTest1")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(bank), `//! g="Foo" n="ParseTest1"`))
+}
@@ -0,0 +1,335 @@
+package fugalist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Store is the persistence layer for a single user's projects. Client is the
+// Firestore implementation; MemoryStore and FileStore work offline.
+type Store interface {
+	ReadUserInfo(ctx context.Context) (*UserInfo, error)
+	ReadProject(ctx context.Context, pid ProjectId) (*Project, error)
+	ReadProjectSummary(ctx context.Context, pid string) (*ProjectSummary, error)
+	SetUrl(ctx context.Context, pid string, url string) error
+	WriteShare(ctx context.Context, share Share) error
+	CreateProject(ctx context.Context, project *Project, summary *ProjectSummary) error
+	UpdateProject(ctx context.Context, project *Project, summary *ProjectSummary) error
+	DeleteProject(ctx context.Context, pid ProjectId) error
+}
+
+var _ Store = (*Client)(nil)
+var _ Store = (*MemoryStore)(nil)
+var _ Store = (*FileStore)(nil)
+
+// ErrNotFound is returned (wrapped) by the offline stores when a document does not exist,
+// and by Client.ReadProject when the project does not.
+var ErrNotFound = errors.New("not found")
+
+// ErrProjectExists is returned (wrapped) by the offline stores when creating a project whose id is taken.
+var ErrProjectExists = errors.New("project already exists")
+
+// ErrStaleProject is returned (wrapped) by UpdateProject when the stored project has been
+// modified since the caller read it.
+var ErrStaleProject = errors.New("project has been modified since it was read")
+
+// storeTime returns the current time at the resolution Firestore stores timestamps, so
+// that a ModifyTime handed back to the caller compares equal to the stored one.
+func storeTime() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// prepareNewProject returns copies of a project about to be created and its summary, with
+// the id and timestamps filled in, middle C named and the summary agreeing with the project.
+// The caller's values are left alone so that they change only if the write succeeds.
+func prepareNewProject(project *Project, summary *ProjectSummary) (Project, ProjectSummary) {
+	now := storeTime()
+	p, s := *project, *summary
+	p.MiddleC = p.MiddleC.Named()
+	if p.ProjectId == "" {
+		p.ProjectId = Uniq()
+	}
+	if p.CreateTime.IsZero() {
+		p.CreateTime = now
+	}
+	p.ModifyTime = now
+	s.ProjectID = p.ProjectId
+	s.CreateTime = p.CreateTime
+	s.ModifyTime = now
+	return p, s
+}
+
+// blobs holds named JSON documents. It is what distinguishes MemoryStore from FileStore.
+type blobs interface {
+	get(name string) ([]byte, error)
+	put(name string, data []byte) error
+	remove(name string) error
+}
+
+// docStore implements Store on top of blobs, using the same layout as test_input:
+// <pid>.project.json, <pid>.summary.json, user.json and shared/<pid>.<version>.json.
+type docStore struct {
+	mu    sync.Mutex
+	blobs blobs
+	uid   string
+}
+
+func projectDoc(pid string) string {
+	return fmt.Sprintf("%s.project.json", pid)
+}
+
+func summaryDoc(pid string) string {
+	return fmt.Sprintf("%s.summary.json", pid)
+}
+
+func shareDoc(pid string, version int) string {
+	return fmt.Sprintf("shared/%s.%d.json", pid, version)
+}
+
+const userDoc = "user.json"
+
+func (s *docStore) read(name string, v interface{}) error {
+	data, err := s.blobs.get(name)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *docStore) write(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return s.blobs.put(name, data)
+}
+
+func (s *docStore) ReadUserInfo(ctx context.Context) (*UserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result UserInfo
+	err := s.read(userDoc, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user info: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *docStore) ReadProject(ctx context.Context, pid ProjectId) (*Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var p Project
+	err := s.read(projectDoc(pid), &p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project %s.%s: %w", s.uid, pid, err)
+	}
+	return &p, nil
+}
+
+func (s *docStore) ReadProjectSummary(ctx context.Context, pid string) (*ProjectSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := &ProjectSummary{}
+	err := s.read(summaryDoc(pid), result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project summary for %s.%s: %w", s.uid, pid, err)
+	}
+	return result, nil
+}
+
+func (s *docStore) SetUrl(ctx context.Context, pid string, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var summary ProjectSummary
+	err := s.read(summaryDoc(pid), &summary)
+	if err != nil {
+		return fmt.Errorf("failed to set url: %w", err)
+	}
+	summary.ExpressionMapURL = url
+	summary.ExpressionMapTime = time.Now()
+	err = s.write(summaryDoc(pid), summary)
+	if err != nil {
+		return fmt.Errorf("failed to set url: %w", err)
+	}
+	return nil
+}
+
+// WriteShare writes the Share record and marks the previous Share record as "Superseded". Also increments
+// the version in the summary.
+func (s *docStore) WriteShare(ctx context.Context, share Share) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if share.UID != s.uid {
+		return fmt.Errorf("failed to share project %s.%s.%d: store belongs to %s", share.UID, share.PID, share.Summary.Version, s.uid)
+	}
+	var summary ProjectSummary
+	err := s.read(summaryDoc(share.PID), &summary)
+	if err != nil {
+		return fmt.Errorf("failed to share project %s.%s.%d: %w", share.UID, share.PID, share.Summary.Version, err)
+	}
+	var prev *Share = nil
+	if share.Summary.Version > 1 {
+		prev = &Share{}
+		err = s.read(shareDoc(share.PID, share.Summary.Version-1), prev)
+		if err != nil {
+			return fmt.Errorf("failed to share project %s.%s.%d: %w", share.UID, share.PID, share.Summary.Version, err)
+		}
+	}
+
+	now := time.Now()
+	if share.CreateTime.IsZero() {
+		share.CreateTime = now
+	}
+	summary.ShareTime = now
+	summary.Version++
+	err = s.write(shareDoc(share.PID, share.Summary.Version), share)
+	if err == nil {
+		err = s.write(summaryDoc(share.PID), summary)
+	}
+	if err == nil && prev != nil {
+		prev.Superseded = true
+		err = s.write(shareDoc(share.PID, share.Summary.Version-1), prev)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to share project %s.%s.%d: %w", share.UID, share.PID, share.Summary.Version, err)
+	}
+	return nil
+}
+
+// CreateProject writes a new project and its summary. The project id is generated if empty
+// and the create and modify times are set. An old middle C string is stored by name.
+func (s *docStore) CreateProject(ctx context.Context, project *Project, summary *ProjectSummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if project.ProjectId != "" {
+		_, err := s.blobs.get(projectDoc(project.ProjectId))
+		if err == nil {
+			err = ErrProjectExists
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to create project %s.%s: %w", s.uid, project.ProjectId, err)
+		}
+	}
+	created, createdSummary := prepareNewProject(project, summary)
+	err := s.write(projectDoc(created.ProjectId), &created)
+	if err == nil {
+		err = s.write(summaryDoc(created.ProjectId), &createdSummary)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create project %s.%s: %w", s.uid, created.ProjectId, err)
+	}
+	*project, *summary = created, createdSummary
+	return nil
+}
+
+// UpdateProject replaces a project and, if summary is not nil, its summary. The update is
+// rejected with ErrStaleProject unless project.ModifyTime matches the stored project. On
+// success the modify times are advanced. An old middle C string is stored by name.
+func (s *docStore) UpdateProject(ctx context.Context, project *Project, summary *ProjectSummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pid := project.ProjectId
+	var stored Project
+	err := s.read(projectDoc(pid), &stored)
+	if err != nil {
+		return fmt.Errorf("failed to update project %s.%s: %w", s.uid, pid, err)
+	}
+	if !stored.ModifyTime.Equal(project.ModifyTime) {
+		return fmt.Errorf("failed to update project %s.%s: %w", s.uid, pid, ErrStaleProject)
+	}
+	if summary == nil {
+		summary = &ProjectSummary{}
+		err = s.read(summaryDoc(pid), summary)
+		if err != nil {
+			return fmt.Errorf("failed to update project %s.%s: %w", s.uid, pid, err)
+		}
+	}
+	// Write copies so that the caller's project and summary change only if the write does.
+	now := storeTime()
+	updatedProject, updatedSummary := *project, *summary
+	updatedProject.MiddleC = project.MiddleC.Named()
+	updatedProject.CreateTime = stored.CreateTime
+	updatedProject.ModifyTime = now
+	updatedSummary.ProjectID = pid
+	updatedSummary.ModifyTime = now
+	err = s.write(projectDoc(pid), &updatedProject)
+	if err == nil {
+		err = s.write(summaryDoc(pid), &updatedSummary)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update project %s.%s: %w", s.uid, pid, err)
+	}
+	*project, *summary = updatedProject, updatedSummary
+	return nil
+}
+
+// DeleteProject deletes a project, its summary and every Share record made from it.
+func (s *docStore) DeleteProject(ctx context.Context, pid ProjectId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var summary ProjectSummary
+	err := s.read(summaryDoc(pid), &summary)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to delete project %s.%s: %w", s.uid, pid, err)
+	}
+	for v := 0; v <= summary.Version; v++ {
+		err = s.blobs.remove(shareDoc(pid, v))
+		if err != nil {
+			return fmt.Errorf("failed to delete share %s.%d: %w", pid, v, err)
+		}
+	}
+	err = s.blobs.remove(summaryDoc(pid))
+	if err == nil {
+		err = s.blobs.remove(projectDoc(pid))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete project %s.%s: %w", s.uid, pid, err)
+	}
+	return nil
+}
+
+// ReadShare reads a Share record written by WriteShare.
+func (s *docStore) ReadShare(ctx context.Context, pid string, version int) (*Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := &Share{}
+	err := s.read(shareDoc(pid, version), result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read share %s.%d: %w", pid, version, err)
+	}
+	return result, nil
+}
+
+// Seed writes user info, projects and summaries directly, bypassing timestamps and
+// versioning. It is meant for loading fixtures into an offline store.
+func (s *docStore) Seed(user *UserInfo, projects []Project, summaries []ProjectSummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user != nil {
+		err := s.write(userDoc, user)
+		if err != nil {
+			return fmt.Errorf("failed to seed user info: %w", err)
+		}
+	}
+	for _, p := range projects {
+		err := s.write(projectDoc(p.ProjectId), p)
+		if err != nil {
+			return fmt.Errorf("failed to seed project: %w", err)
+		}
+	}
+	for _, summary := range summaries {
+		err := s.write(summaryDoc(summary.ProjectID), summary)
+		if err != nil {
+			return fmt.Errorf("failed to seed project summary: %w", err)
+		}
+	}
+	return nil
+}
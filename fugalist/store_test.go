@@ -0,0 +1,302 @@
+package fugalist
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type storeWithSeed interface {
+	Store
+	Seed(user *UserInfo, projects []Project, summaries []ProjectSummary) error
+	ReadShare(ctx context.Context, pid string, version int) (*Share, error)
+}
+
+func offlineStores(t *testing.T, uid string) map[string]storeWithSeed {
+	return map[string]storeWithSeed{
+		"memory": NewMemoryStore(uid),
+		"file":   NewFileStore(t.TempDir(), uid),
+	}
+}
+
+func TestStore_ReadProject(t *testing.T) {
+	for name, store := range offlineStores(t, "fred") {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user := UserInfo{DisplayName: "Fred Flintstone"}
+			err := store.Seed(&user, []Project{project1}, []ProjectSummary{summary1})
+			assert.Nil(t, err)
+
+			u, err := store.ReadUserInfo(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, "Fred Flintstone", u.DisplayName)
+
+			p, err := store.ReadProject(ctx, pid)
+			assert.Nil(t, err)
+			assert.WithinDuration(t, project1.CreateTime, p.CreateTime, time.Nanosecond)
+			assert.Equal(t, project1.Axes, p.Axes)
+			assert.Equal(t, project1.VstSounds, p.VstSounds)
+
+			s, err := store.ReadProjectSummary(ctx, pid)
+			assert.Nil(t, err)
+			assert.Equal(t, summary1.Name, s.Name)
+
+			_, err = store.ReadProject(ctx, "nonesuch")
+			assert.True(t, errors.Is(err, ErrNotFound))
+		})
+	}
+}
+
+func TestStore_ReadProjectIsolated(t *testing.T) {
+	store := NewMemoryStore("fred")
+	err := store.Seed(nil, []Project{project1}, nil)
+	assert.Nil(t, err)
+	p, err := store.ReadProject(context.Background(), pid)
+	assert.Nil(t, err)
+	p.VstSounds[vstSound1.Id].Name = "changed"
+	p, err = store.ReadProject(context.Background(), pid)
+	assert.Nil(t, err)
+	assert.Equal(t, vstSound1.Name, p.VstSounds[vstSound1.Id].Name)
+}
+
+func TestStore_SetUrl(t *testing.T) {
+	for name, store := range offlineStores(t, "fred") {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			err := store.Seed(nil, nil, []ProjectSummary{summary1})
+			assert.Nil(t, err)
+			url := "http://foo/bar"
+			err = store.SetUrl(ctx, pid, url)
+			assert.Nil(t, err)
+			s, err := store.ReadProjectSummary(ctx, pid)
+			assert.Nil(t, err)
+			assert.Equal(t, url, s.ExpressionMapURL)
+			assert.WithinDuration(t, time.Now(), s.ExpressionMapTime, time.Second)
+		})
+	}
+}
+
+func TestStore_WriteShare(t *testing.T) {
+	for name, store := range offlineStores(t, "fred") {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			summary := summary1
+			summary.Version = 1
+			err := store.Seed(nil, nil, []ProjectSummary{summary})
+			assert.Nil(t, err)
+
+			err = store.WriteShare(ctx, Share{UID: "fred", PID: pid, Summary: summary})
+			assert.Nil(t, err)
+			s, err := store.ReadProjectSummary(ctx, pid)
+			assert.Nil(t, err)
+			assert.Equal(t, 2, s.Version)
+
+			err = store.WriteShare(ctx, Share{UID: "fred", PID: pid, Summary: *s})
+			assert.Nil(t, err)
+			first, err := store.ReadShare(ctx, pid, 1)
+			assert.Nil(t, err)
+			assert.True(t, first.Superseded)
+			second, err := store.ReadShare(ctx, pid, 2)
+			assert.Nil(t, err)
+			assert.False(t, second.Superseded)
+
+			err = store.WriteShare(ctx, Share{UID: "barney", PID: pid, Summary: *s})
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestGenerateDoricoLib(t *testing.T) {
+	store := NewFileStore("test_input", "fred")
+	lib, err := GenerateDoricoLib(context.Background(), store, "ParseTest1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(lib.ExpressionMaps.Entities.Contents))
+	assert.Equal(t, "ParseTest1", lib.ExpressionMaps.Entities.Contents[0].Name)
+}
+
+func TestStore_CreateProject(t *testing.T) {
+	for name, store := range offlineStores(t, "fred") {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			p := project1
+			p.ProjectId = ""
+			s := summary1
+			err := store.CreateProject(ctx, &p, &s)
+			assert.Nil(t, err)
+			assert.NotEqual(t, "", p.ProjectId)
+			assert.Equal(t, p.ProjectId, s.ProjectID)
+			assert.Equal(t, p.ModifyTime, s.ModifyTime)
+
+			stored, err := store.ReadProject(ctx, p.ProjectId)
+			assert.Nil(t, err)
+			assert.True(t, p.ModifyTime.Equal(stored.ModifyTime))
+			storedSummary, err := store.ReadProjectSummary(ctx, p.ProjectId)
+			assert.Nil(t, err)
+			assert.Equal(t, summary1.Name, storedSummary.Name)
+
+			again := project1
+			again.ProjectId = p.ProjectId
+			err = store.CreateProject(ctx, &again, &s)
+			assert.True(t, errors.Is(err, ErrProjectExists))
+		})
+	}
+}
+
+func TestStore_UpdateProject(t *testing.T) {
+	for name, store := range offlineStores(t, "fred") {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			p := project1
+			s := summary1
+			err := store.CreateProject(ctx, &p, &s)
+			assert.Nil(t, err)
+
+			first, err := store.ReadProject(ctx, p.ProjectId)
+			assert.Nil(t, err)
+			second, err := store.ReadProject(ctx, p.ProjectId)
+			assert.Nil(t, err)
+
+			first.MiddleC = "C3"
+			err = store.UpdateProject(ctx, first, nil)
+			assert.Nil(t, err)
+			second.MiddleC = "C5"
+			err = store.UpdateProject(ctx, second, nil)
+			assert.True(t, errors.Is(err, ErrStaleProject))
+
+			first.MiddleC = "C5"
+			s.Name = "Renamed"
+			err = store.UpdateProject(ctx, first, &s)
+			assert.Nil(t, err)
+
+			stored, err := store.ReadProject(ctx, p.ProjectId)
+			assert.Nil(t, err)
+			assert.Equal(t, MiddleC5, stored.MiddleC)
+			assert.True(t, first.ModifyTime.Equal(stored.ModifyTime))
+			storedSummary, err := store.ReadProjectSummary(ctx, p.ProjectId)
+			assert.Nil(t, err)
+			assert.Equal(t, "Renamed", storedSummary.Name)
+			assert.True(t, first.ModifyTime.Equal(storedSummary.ModifyTime))
+
+			missing := project1
+			missing.ProjectId = "nonesuch"
+			err = store.UpdateProject(ctx, &missing, nil)
+			assert.True(t, errors.Is(err, ErrNotFound))
+		})
+	}
+}
+
+func TestStore_DeleteProject(t *testing.T) {
+	for name, store := range offlineStores(t, "fred") {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			p := project1
+			s := summary1
+			s.Version = 1
+			err := store.CreateProject(ctx, &p, &s)
+			assert.Nil(t, err)
+			err = store.WriteShare(ctx, Share{UID: "fred", PID: p.ProjectId, Summary: s})
+			assert.Nil(t, err)
+			s.Version = 2
+			err = store.WriteShare(ctx, Share{UID: "fred", PID: p.ProjectId, Summary: s})
+			assert.Nil(t, err)
+
+			err = store.DeleteProject(ctx, p.ProjectId)
+			assert.Nil(t, err)
+			_, err = store.ReadProject(ctx, p.ProjectId)
+			assert.True(t, errors.Is(err, ErrNotFound))
+			_, err = store.ReadProjectSummary(ctx, p.ProjectId)
+			assert.True(t, errors.Is(err, ErrNotFound))
+			_, err = store.ReadShare(ctx, p.ProjectId, 1)
+			assert.True(t, errors.Is(err, ErrNotFound))
+			_, err = store.ReadShare(ctx, p.ProjectId, 2)
+			assert.True(t, errors.Is(err, ErrNotFound))
+		})
+	}
+}
+
+// failingBlobs reads like memBlobs but refuses every write once failing is set, and every
+// read once unreadable is set.
+type failingBlobs struct {
+	memBlobs
+	failing    bool
+	unreadable bool
+}
+
+func (b *failingBlobs) get(name string) ([]byte, error) {
+	if b.unreadable {
+		return nil, errors.New("disk on fire")
+	}
+	return b.memBlobs.get(name)
+}
+
+func (b *failingBlobs) put(name string, data []byte) error {
+	if b.failing {
+		return errors.New("disk full")
+	}
+	return b.memBlobs.put(name, data)
+}
+
+func TestStore_UpdateProjectUnchangedOnFailure(t *testing.T) {
+	ctx := context.Background()
+	blobs := &failingBlobs{memBlobs: make(memBlobs)}
+	store := &docStore{blobs: blobs, uid: "fred"}
+	p := project1
+	s := summary1
+	err := store.CreateProject(ctx, &p, &s)
+	assert.Nil(t, err)
+
+	first, err := store.ReadProject(ctx, p.ProjectId)
+	assert.Nil(t, err)
+	stale, err := store.ReadProject(ctx, p.ProjectId)
+	assert.Nil(t, err)
+	err = store.UpdateProject(ctx, first, nil)
+	assert.Nil(t, err)
+
+	staleTime := stale.ModifyTime
+	err = store.UpdateProject(ctx, stale, nil)
+	assert.True(t, errors.Is(err, ErrStaleProject))
+	assert.True(t, staleTime.Equal(stale.ModifyTime))
+
+	blobs.failing = true
+	firstTime := first.ModifyTime
+	summary := ProjectSummary{Name: "Renamed"}
+	err = store.UpdateProject(ctx, first, &summary)
+	assert.NotNil(t, err)
+	assert.True(t, firstTime.Equal(first.ModifyTime))
+	assert.True(t, summary.ModifyTime.IsZero())
+	assert.Equal(t, "", summary.ProjectID)
+
+	blobs.failing = false
+	err = store.UpdateProject(ctx, first, nil)
+	assert.Nil(t, err)
+}
+
+func TestStore_CreateProjectUnchangedOnFailure(t *testing.T) {
+	ctx := context.Background()
+	blobs := &failingBlobs{memBlobs: make(memBlobs)}
+	store := &docStore{blobs: blobs, uid: "fred"}
+
+	blobs.failing = true
+	p := Project{MiddleC: "C3"}
+	s := ProjectSummary{Name: "New"}
+	err := store.CreateProject(ctx, &p, &s)
+	assert.NotNil(t, err)
+	assert.Equal(t, Project{MiddleC: "C3"}, p)
+	assert.Equal(t, ProjectSummary{Name: "New"}, s)
+
+	// A read that fails for any reason but absence is not taken to mean the id is free.
+	blobs.failing, blobs.unreadable = false, true
+	p.ProjectId = "taken"
+	err = store.CreateProject(ctx, &p, &s)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrProjectExists))
+	assert.True(t, p.CreateTime.IsZero())
+
+	blobs.unreadable = false
+	err = store.CreateProject(ctx, &p, &s)
+	assert.Nil(t, err)
+	assert.Equal(t, Yamaha, p.MiddleC)
+	assert.Equal(t, "taken", s.ProjectID)
+}
@@ -0,0 +1,120 @@
+package fugalist
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+)
+
+// StudioOneSoundSet is the root of a Studio One sound variations file (.soundset).
+type StudioOneSoundSet struct {
+	XMLName    xml.Name                  `xml:"SoundSet"`
+	Name       string                    `xml:"name,attr"`
+	Variations []StudioOneSoundVariation `xml:"SoundVariation"`
+}
+
+// StudioOneSoundVariation is one sound variation and the MIDI messages that activate it.
+type StudioOneSoundVariation struct {
+	Name       string              `xml:"name,attr"`
+	Id         string              `xml:"id,attr"`
+	Activation StudioOneActivation `xml:"List"`
+}
+
+// StudioOneActivation lists the MIDI messages sent when a variation is selected.
+type StudioOneActivation struct {
+	Id       string             `xml:"x:id,attr"`
+	Messages []StudioOneMessage `xml:"MidiMessage"`
+}
+
+// StudioOneMessage is a MIDI message with Studio One's status and data bytes.
+type StudioOneMessage struct {
+	Status int `xml:"status,attr"`
+	Data1  int `xml:"data1,attr"`
+	Data2  int `xml:"data2,attr"`
+}
+
+// StudioOneMessageFor converts a Dorico switch action into a Studio One MIDI message.
+// Studio One uses the same status bytes as Cubase.
+func StudioOneMessageFor(action doricolib.SwitchAction) (StudioOneMessage, error) {
+	status, data1, data2, err := CubaseOutputEvent(action)
+	if err != nil {
+		return StudioOneMessage{}, fmt.Errorf("no Studio One equivalent for %s", action.Type)
+	}
+	if status == cubaseProgramChange {
+		data2 = 0
+	}
+	return StudioOneMessage{Status: status, Data1: data1, Data2: data2}, nil
+}
+
+// studioOneId returns a stable id for a variation so that re-exporting a project does not
+// disturb the variations already chosen in a song.
+func studioOneId(pid string, name string) string {
+	return "{" + uuid.NewSHA1(uuid.NameSpaceOID, []byte(pid+"/"+name)).String() + "}"
+}
+
+// CreateStudioOneSoundSet creates a Studio One sound variations file for the project. Each
+// assigned combination becomes a sound variation named after its techniques and activated
+// by its switch-on actions, sent on the channel of its channel change, if any. Composite
+// sounds play their first branch; tints have no Studio One equivalent. Combinations that
+// change channel relative to the track are left out with a warning.
+func (p *Project) CreateStudioOneSoundSet(summary ProjectSummary) ([]byte, Warnings, error) {
+	articulations, err := p.Articulations()
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings Warnings
+	soundSet := StudioOneSoundSet{Name: summary.Name, Variations: make([]StudioOneSoundVariation, 0)}
+	for _, articulation := range articulations {
+		channel, actions, relative, err := channelChange(articulation.Combo.SwitchOnActions.SwitchOnActions)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create sound variation %s: %w", articulation.Name, err)
+		}
+		if relative {
+			warnings.add("left out sound variation %s: Studio One has no relative channel change", articulation.Name)
+			continue
+		}
+		if channel >= 0 && len(actions) == 0 {
+			warnings.add("sound variation %s sends no messages, so Studio One can't change its channel", articulation.Name)
+		}
+		variation := StudioOneSoundVariation{
+			Name:       articulation.Name,
+			Id:         studioOneId(p.ProjectId, articulation.Name),
+			Activation: StudioOneActivation{Id: "activation", Messages: make([]StudioOneMessage, 0)},
+		}
+		for _, action := range actions {
+			message, err := StudioOneMessageFor(action)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create sound variation %s: %w", articulation.Name, err)
+			}
+			if channel >= 0 {
+				// The channel is the low nibble of the status byte.
+				message.Status |= channel
+			}
+			variation.Activation.Messages = append(variation.Activation.Messages, message)
+		}
+		soundSet.Variations = append(soundSet.Variations, variation)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&out)
+	encoder.Indent("", "\t")
+	err = encoder.Encode(soundSet)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write Studio One sound set: %w", err)
+	}
+	return out.Bytes(), warnings, nil
+}
+
+// GenerateStudioOneSoundSet reads a project and its summary from store and creates a
+// Studio One sound variations file for it.
+func GenerateStudioOneSoundSet(ctx context.Context, store Store, pid string) ([]byte, Warnings, error) {
+	project, projectSummary, err := readProjectAndSummary(ctx, store, pid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return project.CreateStudioOneSoundSet(*projectSummary)
+}
@@ -0,0 +1,94 @@
+package fugalist
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStudioOneMessageFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   doricolib.SwitchAction
+		expected StudioOneMessage
+		err      bool
+	}{
+		{"KS", doricolib.SwitchAction{Type: "kKeySwitch", Param1: "24", Param2: "100"}, StudioOneMessage{144, 24, 100}, false},
+		{"CC", doricolib.SwitchAction{Type: "kControlChange", Param1: "1", Param2: "64"}, StudioOneMessage{176, 1, 64}, false},
+		{"PC", doricolib.SwitchAction{Type: "kProgramChange", Param1: "7", Param2: "0"}, StudioOneMessage{192, 7, 0}, false},
+		{"unknown", doricolib.SwitchAction{Type: "kBogus"}, StudioOneMessage{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := StudioOneMessageFor(test.action)
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expected, message)
+			}
+		})
+	}
+}
+
+func TestCreateStudioOneSoundSet(t *testing.T) {
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "KS1=100, CC1=64"}
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "PC3"}
+	project := &Project{
+		ProjectId: "abc",
+		Axes:      map[string]Axis{axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{legato.Id: legato, natural.Id: natural},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+	}
+	data, warnings, err := project.CreateStudioOneSoundSet(ProjectSummary{Name: "Strings"})
+	assert.Nil(t, err)
+	assert.Empty(t, warnings)
+
+	var soundSet StudioOneSoundSet
+	assert.Nil(t, xml.Unmarshal(data, &soundSet))
+	assert.Equal(t, "Strings", soundSet.Name)
+	assert.Equal(t, 2, len(soundSet.Variations))
+	assert.Equal(t, "Natural", soundSet.Variations[0].Name)
+	assert.Equal(t, []StudioOneMessage{{192, 3, 0}}, soundSet.Variations[0].Activation.Messages)
+	assert.Equal(t, "Legato", soundSet.Variations[1].Name)
+	assert.Equal(t, []StudioOneMessage{{144, 1, 100}, {176, 1, 64}}, soundSet.Variations[1].Activation.Messages)
+
+	again, _, err := project.CreateStudioOneSoundSet(ProjectSummary{Name: "Strings"})
+	assert.Nil(t, err)
+	assert.Equal(t, string(data), string(again))
+}
+
+func TestCreateStudioOneSoundSet_Channels(t *testing.T) {
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "ch3, KS1=100, CC1=64"}
+	natural := &VstSound{Id: Uniq(), Name: "natural", Midi: "ch-1, PC3"}
+	project := &Project{
+		ProjectId: "abc",
+		Axes:      map[string]Axis{axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{legato.Id: legato, natural.Id: natural},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: legato.Id},
+		},
+	}
+	data, warnings, err := project.CreateStudioOneSoundSet(ProjectSummary{Name: "Strings"})
+	assert.Nil(t, err)
+	assert.Equal(t, Warnings{"left out sound variation Natural: Studio One has no relative channel change"}, warnings)
+
+	var soundSet StudioOneSoundSet
+	assert.Nil(t, xml.Unmarshal(data, &soundSet))
+	if assert.Equal(t, 1, len(soundSet.Variations)) {
+		assert.Equal(t, "Legato", soundSet.Variations[0].Name)
+		assert.Equal(t, []StudioOneMessage{{146, 1, 100}, {178, 1, 64}}, soundSet.Variations[0].Activation.Messages)
+	}
+}
+
+func TestGenerateStudioOneSoundSet(t *testing.T) {
+	data, _, err := GenerateStudioOneSoundSet(context.Background(), NewFileStore("test_input", "fred"), "ParseTest1")
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `<SoundSet name="ParseTest1">`)
+}
@@ -0,0 +1,106 @@
+package fugalist
+
+import (
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Spitfire's Universal Articulation Control Change spec selects an articulation with one
+// value per articulation on the controller StandardControllers calls "UACC". UACC-KS sends
+// the same values as the velocity of a key switch instead.
+
+// UACCArticulations are the UACC values fugalist knows by name. A VstSound may give any
+// other value by number.
+var UACCArticulations = map[string]int{
+	"Long":          1,
+	"Long Light":    2,
+	"Long Heavy":    3,
+	"Long Layered":  4,
+	"Legato":        20,
+	"Legato Light":  21,
+	"Legato Heavy":  22,
+	"Short":         40,
+	"Spiccato":      42,
+	"Staccato":      43,
+	"Staccatissimo": 44,
+	"Pizzicato":     56,
+	"Bartok":        57,
+	"Col Legno":     58,
+	"Tremolo":       70,
+	"Trill Minor":   80,
+	"Trill Major":   81,
+}
+
+// UACCValue returns the CC32 value of a UACC articulation, given by name, without regard to
+// case, or by number.
+func UACCValue(articulation string) (int, error) {
+	articulation = strings.TrimSpace(articulation)
+	if value, err := strconv.Atoi(articulation); err == nil {
+		if value < 1 || value > 127 {
+			return 0, fmt.Errorf("UACC value out of range 1..127: %d", value)
+		}
+		return value, nil
+	}
+	for name, value := range UACCArticulations {
+		if strings.EqualFold(name, articulation) {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown UACC articulation: %q", articulation)
+}
+
+// UACCName returns the name of a UACC value, or "" if fugalist does not know it.
+func UACCName(value int) string {
+	for name, v := range UACCArticulations {
+		if v == value {
+			return name
+		}
+	}
+	return ""
+}
+
+// uaccAction returns the switch action that selects a UACC value: a CC32 or, for UACC-KS,
+// the single key switch written in keySwitch, played with the value as its velocity.
+func uaccAction(value int, keySwitch string, middleC OctaveConvention, macros Macros, controllers Controllers) (doricolib.SwitchAction, error) {
+	if keySwitch == "" {
+		return doricolib.SwitchAction{
+			Type:   "kControlChange",
+			Param1: strconv.Itoa(StandardControllers["UACC"]),
+			Param2: strconv.Itoa(value),
+		}, nil
+	}
+	actions, err := ParseActionList(keySwitch, middleC, macros, controllers)
+	if err != nil {
+		return doricolib.SwitchAction{}, err
+	}
+	if len(actions) != 1 || actions[0].Type != "kKeySwitch" {
+		return doricolib.SwitchAction{}, fmt.Errorf("UACC-KS needs a single key switch: %q", keySwitch)
+	}
+	action := actions[0]
+	action.Param2 = strconv.Itoa(value)
+	return action, nil
+}
+
+var uaccActionPat = regexp.MustCompile(`^(?:(.*\S)\s*,)?\s*CC32=(\d+)\s*$`)
+
+// uaccArticulation recognizes switch-on actions, in the default notation, that end by
+// selecting a known UACC articulation. It returns the actions before that one and the
+// articulation's name. A CC32 with an unknown value, or right after a CC0, which makes it
+// the second half of a bank select, is left alone.
+func uaccArticulation(midi string) (string, string, bool) {
+	x := uaccActionPat.FindStringSubmatch(midi)
+	if x == nil {
+		return midi, "", false
+	}
+	value, _ := strconv.Atoi(x[2])
+	name := UACCName(value)
+	if name == "" || bankSelectPat.MatchString(x[1]) {
+		return midi, "", false
+	}
+	return x[1], name, true
+}
+
+var bankSelectPat = regexp.MustCompile(`(?:^|,)\s*CC0=\d+$`)
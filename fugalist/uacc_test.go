@@ -0,0 +1,197 @@
+package fugalist
+
+import (
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+func TestUACCValue(t *testing.T) {
+	tests := []struct {
+		articulation string
+		expected     int
+		ok           bool
+	}{
+		{"Long", 1, true},
+		{"legato", 20, true},
+		{" Col Legno ", 58, true},
+		{"42", 42, true},
+		{"99", 99, true},
+		{"0", 0, false},
+		{"128", 0, false},
+		{"Wobble", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.articulation, func(t *testing.T) {
+			value, err := UACCValue(test.articulation)
+			assert.Equal(t, test.ok, err == nil)
+			assert.Equal(t, test.expected, value)
+		})
+	}
+}
+
+func TestUACCName(t *testing.T) {
+	assert.Equal(t, "Spiccato", UACCName(42))
+	assert.Equal(t, "", UACCName(99))
+	for name, value := range UACCArticulations {
+		assert.Equal(t, name, UACCName(value))
+	}
+}
+
+func TestCreateComboForVstSound_UACC(t *testing.T) {
+	tests := []struct {
+		name     string
+		vstSound VstSound
+		expected []doricolib.SwitchAction
+	}{
+		{"alone", VstSound{UACC: "Legato"}, []doricolib.SwitchAction{
+			{Type: "kControlChange", Param1: "32", Param2: "20"},
+		}},
+		{"after midi", VstSound{Midi: "CC1=64", UACC: "99"}, []doricolib.SwitchAction{
+			{Type: "kControlChange", Param1: "1", Param2: "64"},
+			{Type: "kControlChange", Param1: "32", Param2: "99"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			combo, err := CreateComboForVstSound("pt.natural", &test.vstSound, "C3", nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, test.expected, combo.SwitchOnActions.SwitchOnActions)
+		})
+	}
+
+	_, err := CreateComboForVstSound("pt.natural", &VstSound{UACC: "Wobble"}, "C3", nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCreateComboForVstSound_UACCKeySwitch(t *testing.T) {
+	tests := []struct {
+		name     string
+		vstSound VstSound
+		expected []doricolib.SwitchAction
+	}{
+		{"note name", VstSound{UACC: "Staccato", UACCKeySwitch: "C-2"}, []doricolib.SwitchAction{
+			{Type: "kKeySwitch", Param1: "0", Param2: "43"},
+		}},
+		{"after midi", VstSound{Midi: "CC1=64", UACC: "99", UACCKeySwitch: "KS24=100"}, []doricolib.SwitchAction{
+			{Type: "kControlChange", Param1: "1", Param2: "64"},
+			{Type: "kKeySwitch", Param1: "24", Param2: "99"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			combo, err := CreateComboForVstSound("pt.natural", &test.vstSound, "C3", nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, test.expected, combo.SwitchOnActions.SwitchOnActions)
+		})
+	}
+
+	for _, bad := range []string{"CC1=64", "KS1, KS2", "Q"} {
+		_, err := CreateComboForVstSound("pt.natural", &VstSound{UACC: "Long", UACCKeySwitch: bad}, "C3", nil, nil)
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestImportExpressionMap_UACC(t *testing.T) {
+	natural := &VstSound{Id: Uniq(), Name: "natural", UACC: "Long"}
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "KS20, CC32=20"}
+	other := &VstSound{Id: Uniq(), Name: "other", Midi: "KS20, CC32=99"}
+	bank := &VstSound{Id: Uniq(), Name: "bank", Midi: "CC0=1, CC32=1"}
+	project := &Project{
+		Axes:      map[string]Axis{axis1.Id: axis1, axis2.Id: axis2},
+		VstSounds: map[VstSoundId]*VstSound{natural.Id: natural, legato.Id: legato, other.Id: other, bank.Id: bank},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis1.Techniques[0].Id, axis2.Techniques[0].Id}): {Sound: natural.Id},
+			Xor([]string{axis1.Techniques[0].Id, axis2.Techniques[1].Id}): {Sound: legato.Id},
+			Xor([]string{axis1.Techniques[1].Id, axis2.Techniques[0].Id}): {Sound: other.Id},
+			Xor([]string{axis1.Techniques[1].Id, axis2.Techniques[1].Id}): {Sound: bank.Id},
+		},
+	}
+	xmap, err := project.CreateExpressionMap(ProjectSummary{Name: "UACC"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	imported, _, _, err := ImportExpressionMap(xmap)
+	if !assert.Nil(t, err) {
+		return
+	}
+	sounds := make([]string, 0)
+	for _, vstSound := range imported.VstSounds {
+		sounds = append(sounds, vstSound.Name+" | "+vstSound.Midi+" | "+vstSound.UACC)
+	}
+	sort.Strings(sounds)
+	assert.Equal(t, []string{
+		"Legato | KS20 | Legato",
+		"Long |  | Long",
+		"vst-1 | CC0=1, CC32=1 | ",
+		"vst-2 | KS20, CC32=99 | ",
+	}, sounds)
+}
+
+func TestUACCArticulation(t *testing.T) {
+	tests := []struct {
+		midi     string
+		expected string
+		name     string
+	}{
+		{"CC32=43", "", "Staccato"},
+		{"KS20, CC1=64, CC32=43", "KS20, CC1=64", "Staccato"},
+		{"KS20, CC32=99", "KS20, CC32=99", ""},
+		{"CC0=1, CC32=43", "CC0=1, CC32=43", ""},
+		{"CC10=1, CC32=43", "CC10=1", "Staccato"},
+		{"CC32=43, KS20", "CC32=43, KS20", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.midi, func(t *testing.T) {
+			midi, name, ok := uaccArticulation(test.midi)
+			assert.Equal(t, test.expected, midi)
+			assert.Equal(t, test.name, name)
+			assert.Equal(t, test.name != "", ok)
+		})
+	}
+}
+
+func TestGetVstSounds_Names(t *testing.T) {
+	ptMap := PtMap{
+		"pt.legato":   {"": {On: "CC32=20"}},
+		"pt.natural":  {"": {On: "CC32=20, KS1"}},
+		"pt.pizz":     {"": {On: "KS2"}},
+		"pt.staccato": {"": {On: "KS1, CC32=20"}},
+	}
+	for k := 0; k < 10; k++ {
+		names := make(map[string]string)
+		for _, vstSound := range GetVstSounds(ptMap) {
+			names[vstSound.Midi+" | "+vstSound.UACC] = vstSound.Name
+		}
+		assert.Equal(t, map[string]string{
+			" | Legato":       "Legato",
+			"CC32=20, KS1 | ": "vst-1",
+			"KS2 | ":          "vst-2",
+			"KS1 | Legato":    "Legato 2",
+		}, names)
+	}
+}
+
+func TestValidate_UACC(t *testing.T) {
+	project := &Project{
+		ProjectId: "p",
+		VstSounds: map[VstSoundId]*VstSound{
+			"v": {Id: "v", Name: "v", UACC: "Tremolo"},
+			"w": {Id: "w", Name: "w", UACC: "Wobble"},
+			"x": {Id: "x", Name: "x", UACC: "Long", UACCKeySwitch: "C-2"},
+			"y": {Id: "y", Name: "y", UACC: "Long", UACCKeySwitch: "CC1=1"},
+			"z": {Id: "z", Name: "z", UACCKeySwitch: "C-2"},
+		},
+	}
+	diagnostics := Validate(project)
+	fields := make([]string, len(diagnostics))
+	for k, diagnostic := range diagnostics {
+		fields[k] = diagnostic.Id + " " + diagnostic.Field
+	}
+	assert.Equal(t, []string{"w UACC", "y UACCKeySwitch", "z UACCKeySwitch"}, fields)
+}
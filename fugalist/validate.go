@@ -0,0 +1,332 @@
+package fugalist
+
+import (
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Entity kinds named in a Diagnostic.
+const (
+	EntityProject        = "project"
+	EntityAxis           = "axis"
+	EntityTechnique      = "technique"
+	EntityAssignment     = "assignment"
+	EntityVstSound       = "vstSound"
+	EntityCompositeSound = "compositeSound"
+	EntityBranch         = "branch"
+	EntityTint           = "tint"
+	EntityMacro          = "macro"
+	EntityController     = "controller"
+)
+
+// Diagnostic is a problem found by Validate, addressed to the entity and field that cause
+// it so the front end can highlight it.
+type Diagnostic struct {
+	Entity string
+	// Id is the id of the entity: the key for an assignment, the branch id for a branch.
+	Id string
+	// Parent is the id of the entity containing this one (axis or composite sound), if any.
+	Parent  string
+	Field   string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s %s: %s: %s", d.Entity, d.Id, d.Field, d.Message)
+}
+
+type diagnostics []Diagnostic
+
+func (ds *diagnostics) add(entity, id, parent, field, format string, args ...interface{}) {
+	*ds = append(*ds, Diagnostic{
+		Entity:  entity,
+		Id:      id,
+		Parent:  parent,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// IsKnownTechnique reports whether doricolib.GetTechniqueByName accepts name without
+// panicking.
+func IsKnownTechnique(name string) bool {
+	if strings.HasPrefix(name, "Custom: ") {
+		return strings.Count(name, `"`) >= 2
+	}
+	for _, technique := range doricolib.Techniques {
+		if technique.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkActions parses a list of switch actions and checks that their notes, controllers
+// and values are in MIDI range.
+func checkActions(s string, middleC OctaveConvention, macros Macros, controllers Controllers) error {
+	actions, err := ParseActionList(s, middleC, macros, controllers)
+	if err != nil {
+		return err
+	}
+	for _, action := range actions {
+		limit := 127
+		switch action.Type {
+		case ActionPitchBend:
+			limit = 16383
+		case ActionAbsoluteChannel:
+			limit = 15
+		case ActionRelativeChannel:
+			// The channel codec has already checked the offset, which may be negative.
+			continue
+		}
+		for _, param := range []string{action.Param1, action.Param2} {
+			if param == "" {
+				continue
+			}
+			n, err := strconv.Atoi(param)
+			if err != nil || n < 0 || n > limit {
+				return fmt.Errorf("%s value out of range 0..%d: %s", action.Type, limit, param)
+			}
+		}
+	}
+	return nil
+}
+
+// checkSwitchActions checks the actions of a sound or tint, which Dorico must also be able
+// to send.
+func checkSwitchActions(s string, middleC OctaveConvention, macros Macros, controllers Controllers) error {
+	if err := checkActions(s, middleC, macros, controllers); err != nil {
+		return err
+	}
+	actions, err := ParseActionList(s, middleC, macros, controllers)
+	if err != nil {
+		return err
+	}
+	return doricoCanSend(actions)
+}
+
+// checkKeySwitchRanges reports the narrowed pitch ranges of sounds in use that contain a
+// note that one of those sounds or a tint uses as a keyswitch. Fields that don't parse
+// have already been reported.
+func checkKeySwitchRanges(p *Project, ds *diagnostics) {
+	var vstSounds []string
+	var compositeSounds []string
+	inUse := make(map[string]bool)
+	for _, key := range sortedKeys(p.Assignments) {
+		sound := p.Assignments[key].Sound
+		if inUse[sound] {
+			continue
+		}
+		inUse[sound] = true
+		if _, ok := p.VstSounds[sound]; ok {
+			vstSounds = append(vstSounds, sound)
+		} else if _, ok := p.CompositeSounds[sound]; ok {
+			compositeSounds = append(compositeSounds, sound)
+		}
+	}
+
+	keySwitches := make(map[int]bool)
+	add := func(s string) {
+		actions, err := ParseActionList(s, p.MiddleC, p.Macros, p.Controllers)
+		if err == nil {
+			_ = addKeySwitches(keySwitches, actions)
+		}
+	}
+	for _, id := range vstSounds {
+		add(p.VstSounds[id].Midi)
+		add(p.VstSounds[id].Stop)
+		add(p.VstSounds[id].UACCKeySwitch)
+	}
+	for _, id := range compositeSounds {
+		for _, branch := range p.CompositeSounds[id].SortedBranches() {
+			if vstSound, ok := p.VstSounds[branch.VstSoundId]; ok {
+				add(vstSound.Midi)
+				add(vstSound.Stop)
+				add(vstSound.UACCKeySwitch)
+			}
+		}
+	}
+	for _, tint := range p.SortedTints() {
+		add(tint.Midi)
+		add(tint.Stop)
+	}
+
+	check := func(entity, id, parent, pitchRange string) {
+		r, err := ParsePitchRange(pitchRange, p.MiddleC)
+		if err != nil {
+			return
+		}
+		if n, err := keySwitchInRange(r, keySwitches); err == nil && n >= 0 {
+			ds.add(entity, id, parent, "PitchRange", "pitch range %s contains keyswitch %d", pitchRange, n)
+		}
+	}
+	checked := make(map[VstSoundId]bool)
+	for _, id := range vstSounds {
+		checked[id] = true
+		check(EntityVstSound, id, "", p.VstSounds[id].PitchRange)
+	}
+	for _, id := range compositeSounds {
+		for _, branch := range p.CompositeSounds[id].SortedBranches() {
+			vstSound, ok := p.VstSounds[branch.VstSoundId]
+			switch {
+			case branch.PitchRange != "":
+				check(EntityBranch, branch.Id, id, branch.PitchRange)
+			case ok && !checked[vstSound.Id]:
+				// The branch plays the range of its VST sound.
+				checked[vstSound.Id] = true
+				check(EntityVstSound, vstSound.Id, "", vstSound.PitchRange)
+			}
+		}
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]Assignment:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*VstSound:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*CompositeSound:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks a project and returns every problem found, in a stable order. A project
+// with no diagnostics can be turned into an expression map.
+func Validate(p *Project) []Diagnostic {
+	var ds diagnostics
+
+	if _, err := p.MiddleC.Octave(); err != nil {
+		ds.add(EntityProject, p.ProjectId, "", "MiddleC", "%v", err)
+	}
+	for _, name := range p.Controllers.SortedNames() {
+		if err := checkAlias(name, p.Controllers[name]); err != nil {
+			ds.add(EntityController, name, "", "Name", "%v", err)
+		}
+	}
+	for _, name := range p.Macros.SortedNames() {
+		if !MacroNamePat.MatchString(name) {
+			ds.add(EntityMacro, name, "", "Name", "bad macro name: %q", name)
+			continue
+		}
+		// Errors are located in the definition.
+		if err := checkActions(p.Macros[name], p.MiddleC, p.Macros, p.Controllers); err != nil {
+			ds.add(EntityMacro, name, "", "Definition", "%v", err)
+		}
+	}
+
+	for _, axis := range p.SortedAxes() {
+		if len(axis.Techniques) == 0 {
+			ds.add(EntityAxis, axis.Id, "", "Techniques", "axis %s has no techniques", axis.Name)
+			continue
+		}
+		// The first technique of an axis is its default and never reaches Dorico.
+		for _, technique := range axis.Techniques[1:] {
+			if !IsKnownTechnique(technique.Name) {
+				ds.add(EntityTechnique, technique.Id, axis.Id, "Name", "unknown technique: %q", technique.Name)
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(p.Assignments) {
+		sound := p.Assignments[key].Sound
+		if sound == "" {
+			continue
+		}
+		if _, ok := p.VstSounds[sound]; ok {
+			continue
+		}
+		if _, ok := p.CompositeSounds[sound]; ok {
+			continue
+		}
+		ds.add(EntityAssignment, key, "", "Sound", "no such sound: %s", sound)
+	}
+
+	for _, id := range sortedKeys(p.VstSounds) {
+		vstSound := p.VstSounds[id]
+		if err := checkSwitchActions(vstSound.Midi, p.MiddleC, p.Macros, p.Controllers); err != nil {
+			ds.add(EntityVstSound, id, "", "Midi", "%v", err)
+		}
+		if err := checkSwitchActions(vstSound.Stop, p.MiddleC, p.Macros, p.Controllers); err != nil {
+			ds.add(EntityVstSound, id, "", "Stop", "%v", err)
+		}
+		if _, _, err := ParseVolumeSpec(vstSound.Dynamics, p.Controllers); err != nil {
+			ds.add(EntityVstSound, id, "", "Dynamics", "%v", err)
+		}
+		if _, err := ParsePitchRange(vstSound.PitchRange, p.MiddleC); err != nil {
+			ds.add(EntityVstSound, id, "", "PitchRange", "%v", err)
+		}
+		if vstSound.UACC != "" {
+			if _, err := UACCValue(vstSound.UACC); err != nil {
+				ds.add(EntityVstSound, id, "", "UACC", "%v", err)
+			}
+		}
+		if vstSound.UACCKeySwitch != "" {
+			if vstSound.UACC == "" {
+				ds.add(EntityVstSound, id, "", "UACCKeySwitch", "no UACC articulation to select")
+			} else if _, err := uaccAction(1, vstSound.UACCKeySwitch, p.MiddleC, p.Macros, p.Controllers); err != nil {
+				ds.add(EntityVstSound, id, "", "UACCKeySwitch", "%v", err)
+			}
+		}
+		if _, err := ParseAttackSpec(vstSound.Attack); err != nil {
+			ds.add(EntityVstSound, id, "", "Attack", "%v", err)
+		}
+		if vstSound.TicksBefore < 0 {
+			ds.add(EntityVstSound, id, "", "TicksBefore", "must not be negative: %d", vstSound.TicksBefore)
+		}
+		if vstSound.VelocityFactor < 0 {
+			ds.add(EntityVstSound, id, "", "VelocityFactor", "must not be negative: %g", vstSound.VelocityFactor)
+		}
+	}
+
+	for _, id := range sortedKeys(p.CompositeSounds) {
+		compositeSound := p.CompositeSounds[id]
+		if len(compositeSound.Branches) == 0 {
+			ds.add(EntityCompositeSound, id, "", "Branches", "composite sound %s has no branches", compositeSound.Name)
+		}
+		for _, branch := range compositeSound.SortedBranches() {
+			if _, ok := p.VstSounds[branch.VstSoundId]; !ok {
+				ds.add(EntityBranch, branch.Id, id, "VstSoundId", "no such VST sound: %s", branch.VstSoundId)
+			}
+			if _, err := Input(branch.Condition).ParseBranchConditions(); err != nil {
+				ds.add(EntityBranch, branch.Id, id, "Condition", "%v", err)
+			}
+			if branch.Length < 0 {
+				ds.add(EntityBranch, branch.Id, id, "Length", "must not be negative: %g", branch.Length)
+			}
+			if branch.PitchRange != "" {
+				if _, err := ParsePitchRange(branch.PitchRange, p.MiddleC); err != nil {
+					ds.add(EntityBranch, branch.Id, id, "PitchRange", "%v", err)
+				}
+			}
+		}
+	}
+
+	for _, tint := range p.SortedTints() {
+		if !IsKnownTechnique(tint.Name) {
+			ds.add(EntityTint, tint.Id, "", "Name", "unknown technique: %q", tint.Name)
+		}
+		if err := checkSwitchActions(tint.Midi, p.MiddleC, p.Macros, p.Controllers); err != nil {
+			ds.add(EntityTint, tint.Id, "", "Midi", "%v", err)
+		}
+		if err := checkSwitchActions(tint.Stop, p.MiddleC, p.Macros, p.Controllers); err != nil {
+			ds.add(EntityTint, tint.Id, "", "Stop", "%v", err)
+		}
+	}
+
+	checkKeySwitchRanges(p, &ds)
+
+	return ds
+}
@@ -0,0 +1,143 @@
+package fugalist
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidate_Clean(t *testing.T) {
+	assert.Empty(t, Validate(ReadProject(t, "ParseTest1")))
+}
+
+func TestValidate_Generator(t *testing.T) {
+	low := &VstSound{Id: "low", Name: "low", Midi: "C0", PitchRange: "C0:B3"}
+	bend := &VstSound{Id: "bend", Name: "bend", Midi: "PB=100"}
+	reversed := &VstSound{Id: "reversed", Name: "reversed", Dynamics: "CC1 200:100"}
+	plain := &VstSound{Id: "plain", Name: "plain", Midi: "C0"}
+	composite := &CompositeSound{
+		Id:   "composite",
+		Name: "composite",
+		Branches: map[BranchId]Branch{
+			"b1": {Id: "b1", Order: 1, Condition: "nl > short", VstSoundId: plain.Id, PitchRange: "C-1:C3"},
+		},
+	}
+	tint := &Tint{Id: "t1", Order: 1, Name: "Accent", Midi: "AT=10"}
+	tests := []struct {
+		name   string
+		sound  string
+		sounds []*VstSound
+		tint   *Tint
+		entity string
+		id     string
+		parent string
+		field  string
+	}{
+		{"keyswitch in pitch range", low.Id, []*VstSound{low}, nil, EntityVstSound, low.Id, "", "PitchRange"},
+		{"keyswitch in branch pitch range", composite.Id, []*VstSound{plain}, nil, EntityBranch, "b1", composite.Id, "PitchRange"},
+		{"pitch bend", bend.Id, []*VstSound{bend}, nil, EntityVstSound, bend.Id, "", "Midi"},
+		{"aftertouch tint", plain.Id, []*VstSound{plain}, tint, EntityTint, tint.Id, "", "Midi"},
+		{"reversed dynamics range", reversed.Id, []*VstSound{reversed}, nil, EntityVstSound, reversed.Id, "", "Dynamics"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project := &Project{
+				ProjectId: "p",
+				Axes:      map[string]Axis{axis2.Id: axis2},
+				VstSounds: map[VstSoundId]*VstSound{},
+				Assignments: map[string]Assignment{
+					Xor([]string{axis2.Techniques[0].Id}): {Sound: test.sound},
+				},
+				MiddleC: "C4",
+			}
+			if test.sound == composite.Id {
+				project.CompositeSounds = map[CompositeSoundId]*CompositeSound{composite.Id: composite}
+			}
+			for _, sound := range test.sounds {
+				project.VstSounds[sound.Id] = sound
+			}
+			if test.tint != nil {
+				project.Tints = map[string]*Tint{test.tint.Id: test.tint}
+			}
+			diagnostics := Validate(project)
+			if assert.Len(t, diagnostics, 1, "%v", diagnostics) {
+				assert.Equal(t, test.entity, diagnostics[0].Entity)
+				assert.Equal(t, test.id, diagnostics[0].Id)
+				assert.Equal(t, test.parent, diagnostics[0].Parent)
+				assert.Equal(t, test.field, diagnostics[0].Field)
+			}
+			_, err := project.CreateExpressionMap(ProjectSummary{})
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	good := &VstSound{Id: "good", Name: "good", Midi: "KS20"}
+	bad := &VstSound{
+		Id:          "bad",
+		Name:        "bad",
+		Midi:        "KS200",
+		Stop:        "XX",
+		Dynamics:    "loud",
+		PitchRange:  "C4:C2",
+		Attack:      "breath",
+		TicksBefore: -1,
+	}
+	compositeSound := &CompositeSound{
+		Id:   "composite",
+		Name: "composite",
+		Branches: map[BranchId]Branch{
+			"b1": {Id: "b1", Order: 1, Condition: "nl < short", VstSoundId: "missing"},
+			"b2": {Id: "b2", Order: 2, Condition: "nl is long", VstSoundId: good.Id},
+		},
+	}
+	axis := Axis{Id: "axis", Name: "Technique", Techniques: []Technique{
+		{Id: "t0", Name: "Normal"},
+		{Id: "t1", Name: "Legato"},
+		{Id: "t2", Name: "Wobble"},
+	}}
+	project := &Project{
+		ProjectId:       "p",
+		Axes:            map[string]Axis{axis.Id: axis},
+		VstSounds:       map[VstSoundId]*VstSound{good.Id: good, bad.Id: bad},
+		CompositeSounds: map[CompositeSoundId]*CompositeSound{compositeSound.Id: compositeSound},
+		Tints: map[string]*Tint{
+			"tint": {Id: "tint", Order: 1, Name: "Shimmer", Midi: "CC1=300"},
+		},
+		Assignments: map[string]Assignment{
+			"k1": {Sound: good.Id},
+			"k2": {Sound: "gone"},
+		},
+	}
+
+	type address struct {
+		entity, id, parent, field string
+	}
+	actual := make([]address, 0)
+	for _, d := range Validate(project) {
+		assert.NotEmpty(t, d.Message)
+		actual = append(actual, address{d.Entity, d.Id, d.Parent, d.Field})
+	}
+	assert.Equal(t, []address{
+		{EntityTechnique, "t2", "axis", "Name"},
+		{EntityAssignment, "k2", "", "Sound"},
+		{EntityVstSound, "bad", "", "Midi"},
+		{EntityVstSound, "bad", "", "Stop"},
+		{EntityVstSound, "bad", "", "Dynamics"},
+		{EntityVstSound, "bad", "", "PitchRange"},
+		{EntityVstSound, "bad", "", "Attack"},
+		{EntityVstSound, "bad", "", "TicksBefore"},
+		{EntityBranch, "b1", "composite", "VstSoundId"},
+		{EntityBranch, "b2", "composite", "Condition"},
+		{EntityTint, "tint", "", "Name"},
+		{EntityTint, "tint", "", "Midi"},
+	}, actual)
+}
+
+func TestIsKnownTechnique(t *testing.T) {
+	assert.True(t, IsKnownTechnique("Legato"))
+	assert.True(t, IsKnownTechnique(`Custom: "Sul tasto flautando"`))
+	assert.False(t, IsKnownTechnique("Normal"))
+	assert.False(t, IsKnownTechnique("legato"))
+	assert.False(t, IsKnownTechnique("Custom: oops"))
+}
@@ -0,0 +1,11 @@
+package fugalist
+
+import "fmt"
+
+// Warnings lists what an import or export left out without failing, such as an articulation
+// with no Dorico technique. Callers show them to the user.
+type Warnings []string
+
+func (w *Warnings) add(format string, args ...interface{}) {
+	*w = append(*w, fmt.Sprintf(format, args...))
+}
@@ -4,7 +4,9 @@ import "C"
 import (
 	"fmt"
 	"github.com/mhcoffin/go-doricolib/doricolib"
+	"hash/fnv"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -17,6 +19,10 @@ func (p *Project) CreateExpressionMap(summary ProjectSummary) (*doricolib.Expres
 	if err != nil {
 		return nil, fmt.Errorf("failed to create addOns: %w", err)
 	}
+	err = checkDoricoActions(combos.Combos, addOns.TechniqueAddOns)
+	if err != nil {
+		return nil, err
+	}
 
 	em := doricolib.ExpressionMap{
 		Name:                          summary.Name,
@@ -29,6 +35,8 @@ func (p *Project) CreateExpressionMap(summary ProjectSummary) (*doricolib.Expres
 		PluginNames:                   summary.Plugins,
 		AutoMutualExclusion:           false,
 		AllowMultipleNotesAtSamePitch: false,
+		// doricolib has no type for init switch actions, so a project has none to write.
+		// ImportExpressionMap warns about a map that uses them.
 		InitSwitchData: doricolib.InitSwitchData{
 			Enabled: false,
 			InitActions: doricolib.EntityList{
@@ -43,6 +51,44 @@ func (p *Project) CreateExpressionMap(summary ProjectSummary) (*doricolib.Expres
 	return &em, nil
 }
 
+// checkDoricoActions fails if a combination or add-on switches with an action, such as a
+// pitch bend, that Dorico cannot send. The DAW exporters can still play them.
+func checkDoricoActions(combos []*doricolib.PlayingTechniqueCombination, addOns []doricolib.TechniqueAddOn) error {
+	check := func(techniques string, lists ...[]doricolib.SwitchAction) error {
+		for _, actions := range lists {
+			if err := doricoCanSend(actions); err != nil {
+				return fmt.Errorf("%s: %w", techniques, err)
+			}
+		}
+		return nil
+	}
+	for _, combo := range combos {
+		err := check(combo.TechniqueIDs, combo.SwitchOnActions.SwitchOnActions, combo.SwitchOffActions.SwitchOffActions)
+		if err != nil {
+			return err
+		}
+	}
+	for _, addOn := range addOns {
+		err := check(addOn.TechniqueIDs, addOn.SwitchOnActions.SwitchOnActions, addOn.SwitchOffActions.SwitchOffActions)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// doricoCanSend rejects the first action that Dorico has no switch action for.
+func doricoCanSend(actions []doricolib.SwitchAction) error {
+	for _, action := range actions {
+		switch action.Type {
+		case "kKeySwitch", "kControlChange", "kProgramChange", ActionAbsoluteChannel, ActionRelativeChannel:
+		default:
+			return fmt.Errorf("Dorico cannot send %s actions", action.Type)
+		}
+	}
+	return nil
+}
+
 func (p *Project) CreateComboList() (*doricolib.PlayingTechniqueCombinationList, error) {
 	combos, err := p.CreateCombos()
 	if err != nil {
@@ -72,10 +118,11 @@ func (p *Project) CreateCombos() ([]*doricolib.PlayingTechniqueCombination, erro
 			continue
 		}
 		soundId := p.Assignments[key].Sound
+		first := len(r)
 
 		vstSound, isVstSound := p.VstSounds[soundId]
 		if isVstSound {
-			combo, err := CreateComboForVstSound(techniques, vstSound, p.MiddleC)
+			combo, err := CreateComboForVstSound(techniques, vstSound, p.MiddleC, p.Macros, p.Controllers)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create combo for vst sound: %w", err)
 			}
@@ -85,74 +132,202 @@ func (p *Project) CreateCombos() ([]*doricolib.PlayingTechniqueCombination, erro
 			if !isCompositeSound {
 				return nil, fmt.Errorf("no sound for %s (key %s)", techniques, key)
 			}
-			combos, err := CreateCombosForCompositeSound(techniques, compositeSound, p, p.MiddleC)
+			combos, err := CreateCombosForCompositeSound(techniques, compositeSound, p, p.MiddleC, p.Macros, p.Controllers)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create combos for composite sound: %w", err)
 			}
 			r = append(r, combos...)
 		}
+		for _, combo := range r[first:] {
+			cond, err := FormatBranch(combo.ConditionString)
+			if err != nil {
+				return nil, fmt.Errorf("failed to format condition of %s: %w", techniques, err)
+			}
+			switchID, ok := p.Assignments[key].SwitchID(cond)
+			if !ok {
+				switchID = KeySwitchID(key, cond)
+			}
+			combo.BaseSwitchID = switchID
+		}
+	}
+	err := p.checkPitchRanges(r)
+	if err != nil {
+		return nil, err
 	}
 	return r, nil
 }
 
-func CreateComboForVstSound(techniques string, vstSound *VstSound, middleC string) (*doricolib.PlayingTechniqueCombination, error) {
-	volSpec, volRange, err := ParseVolumeSpec(vstSound.Dynamics)
+// checkPitchRanges rejects combinations whose pitch range has been narrowed but still
+// contains a note the project uses as a keyswitch.
+func (p *Project) checkPitchRanges(combos []*doricolib.PlayingTechniqueCombination) error {
+	actions := make([]doricolib.SwitchAction, 0)
+	for _, combo := range combos {
+		actions = append(actions, combo.SwitchOnActions.SwitchOnActions...)
+		actions = append(actions, combo.SwitchOffActions.SwitchOffActions...)
+	}
+	for _, tint := range p.SortedTints() {
+		for _, s := range []string{tint.Midi, tint.Stop} {
+			tintActions, err := ParseActionList(s, p.MiddleC, p.Macros, p.Controllers)
+			if err != nil {
+				return fmt.Errorf("failed to parse actions for tint %s: %w", tint.Name, err)
+			}
+			actions = append(actions, tintActions...)
+		}
+	}
+	keySwitches := make(map[int]bool)
+	if err := addKeySwitches(keySwitches, actions); err != nil {
+		return err
+	}
+
+	for _, combo := range combos {
+		n, err := keySwitchInRange(combo.PitchRange, keySwitches)
+		if err != nil {
+			return err
+		}
+		if n >= 0 {
+			return fmt.Errorf("pitch range %s of %s contains keyswitch %d", combo.PitchRange, combo.TechniqueIDs, n)
+		}
+	}
+	return nil
+}
+
+// addKeySwitches adds the notes of the keyswitch actions to keySwitches.
+func addKeySwitches(keySwitches map[int]bool, actions []doricolib.SwitchAction) error {
+	for _, action := range actions {
+		if action.Type != "kKeySwitch" {
+			continue
+		}
+		n, err := strconv.Atoi(action.Param1)
+		if err != nil {
+			return fmt.Errorf("bad keyswitch: %s", action.Param1)
+		}
+		keySwitches[n] = true
+	}
+	return nil
+}
+
+// keySwitchInRange returns the lowest keyswitch inside a narrowed Dorico pitch range, or -1
+// if there is none. The full range "0,127" is never narrowed.
+func keySwitchInRange(pitchRange string, keySwitches map[int]bool) (int, error) {
+	if pitchRange == "0,127" {
+		return -1, nil
+	}
+	lo, hi, err := splitRange(pitchRange)
+	if err != nil {
+		return -1, err
+	}
+	for n := lo; n <= hi; n++ {
+		if keySwitches[n] {
+			return n, nil
+		}
+	}
+	return -1, nil
+}
+
+// KeySwitchID derives a Dorico base switch id from an assignment key and branch condition,
+// so that the id doesn't change when other assignments are added or removed.
+func KeySwitchID(key string, condition string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + "\x00" + condition))
+	return int(h.Sum32() & 0x7fffffff)
+}
+
+// FlagLengthFactor is the combination flag that makes Dorico apply LengthFactor.
+const FlagLengthFactor = 1
+
+func CreateComboForVstSound(techniques string, vstSound *VstSound, middleC OctaveConvention, macros Macros, controllers Controllers) (*doricolib.PlayingTechniqueCombination, error) {
+	volSpec, volRange, err := ParseVolumeSpec(vstSound.Dynamics, controllers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse dynamics: %w", err)
 	}
-	switchOnActions, err := ParseSwitchOnActionList(vstSound.Midi, middleC)
+	switchOnActions, err := ParseSwitchOnActionList(vstSound.Midi, middleC, macros, controllers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse switch-on actions: %w", err)
 	}
+	if vstSound.UACC != "" {
+		value, err := UACCValue(vstSound.UACC)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse UACC articulation of %s: %w", vstSound.Name, err)
+		}
+		action, err := uaccAction(value, vstSound.UACCKeySwitch, middleC, macros, controllers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse UACC key switch of %s: %w", vstSound.Name, err)
+		}
+		switchOnActions.SwitchOnActions = append(switchOnActions.SwitchOnActions, action)
+	}
+	switchOffActions, err := ParseSwitchOffActionList(vstSound.Stop, middleC, macros, controllers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse switch-off actions: %w", err)
+	}
+	pitchRange, err := ParsePitchRange(vstSound.PitchRange, middleC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pitch range of %s: %w", vstSound.Name, err)
+	}
+	attack, err := ParseAttackSpec(vstSound.Attack)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attack of %s: %w", vstSound.Name, err)
+	}
+	if vstSound.TicksBefore < 0 {
+		return nil, fmt.Errorf("%s: ticks before must not be negative: %d", vstSound.Name, vstSound.TicksBefore)
+	}
+	velocityFactor := "1.0"
+	if vstSound.VelocityFactor < 0 {
+		return nil, fmt.Errorf("%s: velocity factor must not be negative: %g", vstSound.Name, vstSound.VelocityFactor)
+	} else if vstSound.VelocityFactor != 0 {
+		velocityFactor = fmt.Sprintf("%f", vstSound.VelocityFactor)
+	}
 	combo := &doricolib.PlayingTechniqueCombination{
-		TechniqueIDs:    techniques,
-		BaseSwitchID:    0,
-		Enabled:         true,
-		Flags:           0, // TODO
-		ConditionString: "",
-		VelocityRange:   volRange,
-		PitchRange:      "0,127",
-		Transpose:       0,
-		TicksBefore:     0,
-		VelocityFactor:  "1.0",
-		VolumeType:      *volSpec,
-		AttackType: doricolib.AttackType{
-			Type:   "kNoteVelocity",
-			Param1: "0",
-		},
+		TechniqueIDs:     techniques,
+		BaseSwitchID:     0,
+		Enabled:          true,
+		Flags:            vstSound.Flags &^ FlagLengthFactor,
+		ConditionString:  "",
+		VelocityRange:    volRange,
+		PitchRange:       pitchRange,
+		Transpose:        0,
+		TicksBefore:      vstSound.TicksBefore,
+		VelocityFactor:   velocityFactor,
+		VolumeType:       *volSpec,
+		AttackType:       *attack,
 		SwitchOnActions:  *switchOnActions,
-		SwitchOffActions: doricolib.SwitchOffActionList{}, // TODO switch-off actions
+		SwitchOffActions: *switchOffActions,
 	}
 	return combo, nil
 }
 
-func CreateCombosForCompositeSound(techniques string, compositeSound *CompositeSound, p *Project, middleC string) ([]*doricolib.PlayingTechniqueCombination, error) {
-	combos := make([]*doricolib.PlayingTechniqueCombination, len(compositeSound.Branches))
+func CreateCombosForCompositeSound(techniques string, compositeSound *CompositeSound, p *Project, middleC OctaveConvention, macros Macros, controllers Controllers) ([]*doricolib.PlayingTechniqueCombination, error) {
+	combos := make([]*doricolib.PlayingTechniqueCombination, 0, len(compositeSound.Branches))
 
-	k := 0
-	for _, branch := range compositeSound.Branches {
+	for _, branch := range compositeSound.SortedBranches() {
 		vstSound, isVstSound := p.VstSounds[branch.VstSoundId]
 		if !isVstSound {
 			return nil, fmt.Errorf("no such vstSound")
 		}
-		combo, err := CreateComboForVstSound(techniques, vstSound, middleC)
+		combo, err := CreateComboForVstSound(techniques, vstSound, middleC, macros, controllers)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create combo for vstSound: %w", err)
 		}
-		cond, err := Input(branch.Condition).ParseBranchCondition()
+		conditions, err := Input(branch.Condition).ParseBranchConditions()
 		if err != nil {
-			return nil, fmt.Errorf(`failed to parse condition: "%s"`, branch.Condition)
+			return nil, fmt.Errorf(`failed to parse condition: "%s": %w`, branch.Condition, err)
+		}
+
+		// A branch may narrow the pitch range of its sound.
+		if branch.PitchRange != "" {
+			combo.PitchRange, err = ParsePitchRange(branch.PitchRange, middleC)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse pitch range of branch %s: %w", branch.Id, err)
+			}
 		}
-		combo.ConditionString = cond.String()
 
 		// Note length.
 		// NB. If length factor is missing in the DB, reading it returns 0,
 		// which we take to mean missing since a length factor of zero is
 		// not very useful.
 		if branch.Length == 0 {
-			combo.Flags = 0
+			combo.Flags &^= FlagLengthFactor
 		} else {
-			combo.Flags = 1
+			combo.Flags |= FlagLengthFactor
 			combo.LengthFactor = fmt.Sprintf("%f", branch.Length/100.0)
 		}
 
@@ -161,8 +336,12 @@ func CreateCombosForCompositeSound(techniques string, compositeSound *CompositeS
 		// which is what we want anyway.
 		combo.Transpose = int(branch.Transpose)
 
-		combos[k] = combo
-		k++
+		// Dorico cannot express a disjunction, so each disjunct gets a combo of its own.
+		for _, cond := range conditions {
+			c := *combo
+			c.ConditionString = cond.String()
+			combos = append(combos, &c)
+		}
 	}
 	return combos, nil
 }
@@ -172,7 +351,27 @@ func (p *Project) SortedAxes() []Axis {
 	for _, axis := range p.Axes {
 		result = append(result, axis)
 	}
-	sort.Slice(result, func(a, b int) bool { return result[a].SortOrder < result[b].SortOrder })
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].SortOrder != result[b].SortOrder {
+			return result[a].SortOrder < result[b].SortOrder
+		}
+		return result[a].Id < result[b].Id
+	})
+	return result
+}
+
+// SortedBranches returns the branches of a composite sound ordered by Order.
+func (c *CompositeSound) SortedBranches() []Branch {
+	result := make([]Branch, 0, len(c.Branches))
+	for _, branch := range c.Branches {
+		result = append(result, branch)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Order != result[b].Order {
+			return result[a].Order < result[b].Order
+		}
+		return result[a].Id < result[b].Id
+	})
 	return result
 }
 
@@ -214,13 +413,13 @@ func GetSize(axes []Axis) int {
 	return r
 }
 
+// CreateMutualExclusionGroups creates a group for each axis with more than one technique,
+// ordered by SortOrder.
 func CreateMutualExclusionGroups(axes map[string]Axis) *doricolib.MutexGroupList {
-	groups := make([]*doricolib.MutualExclusionGroup, len(axes))
-	k := 0
-	for _, axis := range axes {
+	groups := make([]*doricolib.MutualExclusionGroup, 0, len(axes))
+	for _, axis := range (&Project{Axes: axes}).SortedAxes() {
 		if len(axis.Techniques) > 1 {
-			groups[k] = MutexGroup(&axis)
-			k++
+			groups = append(groups, MutexGroup(&axis))
 		}
 	}
 	return &doricolib.MutexGroupList{
@@ -250,14 +449,12 @@ func rangeString(limits []string) string {
 
 func (p *Project) CreateTechniqueAddOns() (*doricolib.TechniqueAddOnList, error) {
 	addOns := make([]doricolib.TechniqueAddOn, len(p.Tints))
-	k := 0
-	for _, modifier := range p.Tints {
-		addOn, err := CreateTechniqueAddOn(*modifier, p.MiddleC)
+	for k, modifier := range p.SortedTints() {
+		addOn, err := CreateTechniqueAddOn(*modifier, p.MiddleC, p.Macros, p.Controllers)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create add-on: %w", err)
 		}
 		addOns[k] = *addOn
-		k++
 	}
 	result := &doricolib.TechniqueAddOnList{
 		IsArray:         "true",
@@ -266,12 +463,12 @@ func (p *Project) CreateTechniqueAddOns() (*doricolib.TechniqueAddOnList, error)
 	return result, nil
 }
 
-func CreateTechniqueAddOn(modifier Tint, middleC string) (*doricolib.TechniqueAddOn, error) {
-	start, err := ParseSwitchOnActionList(modifier.Midi, middleC)
+func CreateTechniqueAddOn(modifier Tint, middleC OctaveConvention, macros Macros, controllers Controllers) (*doricolib.TechniqueAddOn, error) {
+	start, err := ParseSwitchOnActionList(modifier.Midi, middleC, macros, controllers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse start action list: %w", err)
 	}
-	stop, err := ParseSwitchOffActionList(modifier.Stop, middleC)
+	stop, err := ParseSwitchOffActionList(modifier.Stop, middleC, macros, controllers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse stop action list: %w", err)
 	}
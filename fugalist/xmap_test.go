@@ -1,7 +1,11 @@
 package fugalist
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/mhcoffin/go-doricolib/doricolib"
 	"github.com/stretchr/testify/assert"
+	"strconv"
 	"testing"
 )
 
@@ -50,3 +54,268 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateComboForVstSound_SwitchOffActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		stop     string
+		expected []doricolib.SwitchAction
+		err      bool
+	}{
+		{"none", "", []doricolib.SwitchAction{}, false},
+		{"note", "C1", []doricolib.SwitchAction{{Type: "kKeySwitch", Param1: "36", Param2: "127"}}, false},
+		{"CC", "CC64=0", []doricolib.SwitchAction{{Type: "kControlChange", Param1: "64", Param2: "0"}}, false},
+		{"bad", "XX", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vstSound := &VstSound{Id: Uniq(), Midi: "KS20", Stop: test.stop}
+			combo, err := CreateComboForVstSound("pt.natural", vstSound, "C3", nil, nil)
+			if test.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "true", combo.SwitchOffActions.IsArray)
+			assert.Equal(t, test.expected, combo.SwitchOffActions.SwitchOffActions)
+		})
+	}
+}
+
+func TestCreateCombos_PitchRange(t *testing.T) {
+	low := &VstSound{Id: Uniq(), Name: "low", Midi: "C0", PitchRange: "C1:B3"}
+	high := &VstSound{Id: Uniq(), Name: "high", Midi: "C#0", PitchRange: "C4:C7"}
+	legato := &VstSound{Id: Uniq(), Name: "legato", Midi: "D0"}
+	split := &CompositeSound{
+		Id:   Uniq(),
+		Name: "split",
+		Branches: map[BranchId]Branch{
+			"a": {Id: "a", Order: 1, Condition: "nl < medium", VstSoundId: legato.Id, PitchRange: "60:72"},
+			"b": {Id: "b", Order: 2, Condition: "nl >= medium", VstSoundId: legato.Id},
+		},
+	}
+	project := &Project{
+		Axes:            map[string]Axis{axis2.Id: axis2},
+		VstSounds:       map[VstSoundId]*VstSound{low.Id: low, high.Id: high, legato.Id: legato},
+		CompositeSounds: map[CompositeSoundId]*CompositeSound{split.Id: split},
+		Assignments: map[string]Assignment{
+			Xor([]string{axis2.Techniques[0].Id}): {Sound: low.Id},
+			Xor([]string{axis2.Techniques[1].Id}): {Sound: split.Id},
+		},
+		MiddleC: "C4",
+	}
+	combos, err := project.CreateCombos()
+	if !assert.Nil(t, err) {
+		return
+	}
+	ranges := make(map[string]string)
+	for _, combo := range combos {
+		ranges[combo.TechniqueIDs+" "+combo.ConditionString] = combo.PitchRange
+	}
+	assert.Equal(t, map[string]string{
+		"pt.natural ":                     "24,59",
+		"pt.legato NoteLength < kMedium":  "60,72",
+		"pt.legato NoteLength >= kMedium": "0,127",
+	}, ranges)
+
+	// A range that contains a keyswitch is rejected.
+	low.PitchRange = "C0:B3"
+	_, err = project.CreateCombos()
+	assert.NotNil(t, err)
+
+	low.PitchRange = "C1:B3"
+	project.Tints = map[string]*Tint{"t": {Id: "t", Name: "mute", Midi: "C5"}}
+	split.Branches["a"] = Branch{Id: "a", Order: 1, Condition: "nl < medium", VstSoundId: legato.Id, PitchRange: "60:72"}
+	_, err = project.CreateCombos()
+	assert.NotNil(t, err)
+}
+
+func TestCreateComboForVstSound_Options(t *testing.T) {
+	tests := []struct {
+		name     string
+		vstSound VstSound
+		ticks    int
+		factor   string
+		attack   doricolib.AttackType
+		err      bool
+	}{
+		{"defaults", VstSound{}, 0, "1.0", doricolib.AttackType{Type: "kNoteVelocity", Param1: "0"}, false},
+		{"all", VstSound{TicksBefore: 10, VelocityFactor: 0.5, Attack: "CC2"}, 10, "0.500000", doricolib.AttackType{Type: "kCC", Param1: "2"}, false},
+		{"negative ticks", VstSound{TicksBefore: -1}, 0, "", doricolib.AttackType{}, true},
+		{"negative factor", VstSound{VelocityFactor: -1}, 0, "", doricolib.AttackType{}, true},
+		{"bad attack", VstSound{Attack: "breath"}, 0, "", doricolib.AttackType{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			combo, err := CreateComboForVstSound("pt.natural", &test.vstSound, "C4", nil, nil)
+			if test.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.ticks, combo.TicksBefore)
+			assert.Equal(t, test.factor, combo.VelocityFactor)
+			assert.Equal(t, test.attack, combo.AttackType)
+		})
+	}
+}
+
+func TestCreateCombos_BaseSwitchID(t *testing.T) {
+	project := ReadProject(t, "ParseTest1")
+	combos, err := project.CreateCombos()
+	assert.Nil(t, err)
+	assert.True(t, len(combos) > 1)
+	ids := make(map[string]int)
+	seen := make(map[int]bool)
+	for _, combo := range combos {
+		assert.False(t, seen[combo.BaseSwitchID])
+		seen[combo.BaseSwitchID] = true
+		ids[combo.TechniqueIDs+"/"+combo.ConditionString] = combo.BaseSwitchID
+	}
+
+	// Removing an assignment leaves the ids of the others alone.
+	for key := range project.Assignments {
+		delete(project.Assignments, key)
+		break
+	}
+	combos, err = project.CreateCombos()
+	assert.Nil(t, err)
+	for _, combo := range combos {
+		assert.Equal(t, ids[combo.TechniqueIDs+"/"+combo.ConditionString], combo.BaseSwitchID)
+	}
+
+	// A stored id wins over the derived one.
+	for key, assignment := range project.Assignments {
+		assignment.SwitchIDs = []SwitchID{{Condition: "", ID: 7}}
+		project.Assignments[key] = assignment
+	}
+	combos, err = project.CreateCombos()
+	assert.Nil(t, err)
+	for _, combo := range combos {
+		if combo.ConditionString == "" {
+			assert.Equal(t, 7, combo.BaseSwitchID)
+		}
+	}
+}
+
+func TestCreateExpressionMap_Deterministic(t *testing.T) {
+	project := ReadProject(t, "ParseTest1")
+	project.Tints = map[string]*Tint{}
+	for k, name := range []string{"Accent", "Bell", "Choke", "Con vibrato"} {
+		tint := &Tint{Id: Uniq(), Order: 100 * (4 - k), Name: name, Midi: fmt.Sprintf("CC%d=127", 20+k)}
+		project.Tints[tint.Id] = tint
+	}
+	var expected []byte
+	for k := 0; k < 20; k++ {
+		xmap, err := project.CreateExpressionMap(ProjectSummary{Name: "ParseTest1"})
+		if !assert.Nil(t, err) {
+			return
+		}
+		var out bytes.Buffer
+		assert.Nil(t, doricolib.WriteXml(doricolib.CreateDoricoLib([]doricolib.ExpressionMap{*xmap}), &out))
+		if expected == nil {
+			expected = out.Bytes()
+
+			addOns := xmap.TechniqueAddOns.TechniqueAddOns
+			assert.Equal(t, 4, len(addOns))
+			assert.Equal(t, doricolib.GetTechniqueByName("Con vibrato").Id, addOns[0].TechniqueIDs)
+			assert.Equal(t, "pt.accent", addOns[3].TechniqueIDs)
+			continue
+		}
+		assert.Equal(t, string(expected), out.String())
+	}
+}
+
+func TestCreateCombosForCompositeSound_BranchOrder(t *testing.T) {
+	vstSound := &VstSound{Id: Uniq(), Name: "legato", Midi: "KS20"}
+	compositeSound := &CompositeSound{
+		Id: Uniq(),
+		Branches: map[BranchId]Branch{
+			"a": {Id: "a", Order: 3, Condition: "nl >= long", VstSoundId: vstSound.Id},
+			"b": {Id: "b", Order: 1, Condition: "nl < short", VstSoundId: vstSound.Id},
+			"c": {Id: "c", Order: 2, Condition: "short <= nl < long", VstSoundId: vstSound.Id},
+		},
+	}
+	p := &Project{VstSounds: map[VstSoundId]*VstSound{vstSound.Id: vstSound}}
+	for k := 0; k < 10; k++ {
+		combos, err := CreateCombosForCompositeSound("pt.legato", compositeSound, p, "C4", nil, nil)
+		assert.Nil(t, err)
+		conditions := make([]string, len(combos))
+		for j, combo := range combos {
+			conditions[j] = combo.ConditionString
+		}
+		assert.Equal(t, []string{
+			"NoteLength < kShort",
+			"NoteLength >= kShort AND NoteLength < kLong",
+			"NoteLength >= kLong",
+		}, conditions)
+	}
+}
+
+func TestCreateMutualExclusionGroups(t *testing.T) {
+	single := Axis{Id: "single", Name: "Single", SortOrder: 0, Techniques: []Technique{{"s1", "Normal"}}}
+	first := Axis{Id: "first", Name: "First", SortOrder: 1, Techniques: []Technique{{"f1", "Normal"}, {"f2", "Legato"}}}
+	second := Axis{Id: "second", Name: "Second", SortOrder: 2, Techniques: []Technique{{"t1", "Normal"}, {"t2", "Staccato"}, {"t3", "Tenuto"}}}
+	groups := CreateMutualExclusionGroups(map[string]Axis{second.Id: second, single.Id: single, first.Id: first})
+	assert.Equal(t, []*doricolib.MutualExclusionGroup{
+		{GroupId: "ptmg.user.first", Name: "First", TechniqueIds: "pt.legato"},
+		{GroupId: "ptmg.user.second", Name: "Second", TechniqueIds: "pt.staccato, pt.tenuto"},
+	}, groups.MutualExclusionGroups)
+}
+
+func TestCreateCombosForCompositeSound_Disjunction(t *testing.T) {
+	vstSound := &VstSound{Id: Uniq(), Name: "legato", Midi: "KS20"}
+	other := &VstSound{Id: Uniq(), Name: "other", Midi: "KS21"}
+	compositeSound := &CompositeSound{
+		Id: Uniq(),
+		Branches: map[BranchId]Branch{
+			"a": {Id: "a", Order: 1, Condition: "nl < short or nl >= long", VstSoundId: vstSound.Id, Transpose: 12},
+			"b": {Id: "b", Order: 2, Condition: "not (nl < short or nl >= long)", VstSoundId: other.Id},
+		},
+	}
+	p := &Project{VstSounds: map[VstSoundId]*VstSound{vstSound.Id: vstSound, other.Id: other}}
+	combos, err := CreateCombosForCompositeSound("pt.legato", compositeSound, p, "C4", nil, nil)
+	assert.Nil(t, err)
+	actual := make([][]string, len(combos))
+	for k, combo := range combos {
+		actual[k] = []string{combo.ConditionString, combo.SwitchOnActions.SwitchOnActions[0].Param1, strconv.Itoa(combo.Transpose)}
+	}
+	assert.Equal(t, [][]string{
+		{"NoteLength < kShort", "20", "12"},
+		{"NoteLength >= kLong", "20", "12"},
+		{"NoteLength >= kShort AND NoteLength < kLong", "21", "0"},
+	}, actual)
+}
+
+func TestCreateExpressionMap_NonDoricoActions(t *testing.T) {
+	tests := []struct {
+		name string
+		midi string
+		stop string
+		tint string
+	}{
+		{"pitch bend", "PB=100", "", ""},
+		{"channel pressure stop", "KS20", "AT=0", ""},
+		{"tint", "KS20", "", "PB=-100"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vstSound := &VstSound{Id: Uniq(), Name: "vst", Midi: test.midi, Stop: test.stop}
+			project := &Project{
+				Axes:      map[string]Axis{axis1.Id: axis1},
+				VstSounds: map[VstSoundId]*VstSound{vstSound.Id: vstSound},
+				Tints:     map[string]*Tint{},
+				Assignments: map[string]Assignment{
+					Xor([]string{axis1.Techniques[0].Id}): {Sound: vstSound.Id},
+				},
+			}
+			if test.tint != "" {
+				project.Tints["t"] = &Tint{Id: "t", Name: "Accent", Midi: test.tint}
+			}
+			_, err := project.CreateExpressionMap(ProjectSummary{Name: "bend"})
+			assert.NotNil(t, err)
+			_, err = project.CreateCombos()
+			assert.Nil(t, err)
+		})
+	}
+}